@@ -0,0 +1,379 @@
+package roudetef
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	ht "net/http"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// Analysis tells which routes of a tree don't get the requests
+// they are meant for. Routes are reported in tree order, so the
+// report is the same every time and can be compared in tests:
+//
+//	if err := routeDef.Analyze(nil).Err(); err != nil {
+//		t.Error(err)
+//	}
+type Analysis struct {
+	// requests for a route that are handled by another route,
+	// or by no route at all
+	Shadowed []Shadow
+	// routes that are shadowed for every method
+	Unreachable []string
+	// pairs of routes that match some of the same requests
+	Overlaps []Overlap
+	// routes that weren't checked, since they have transformers
+	// or a path that no sample request could be made for
+	Skipped []string
+}
+
+type Shadow struct {
+	Route  string
+	Path   string
+	Method string
+	// the route that gets the request instead, empty when
+	// no route does
+	By string
+}
+
+func (s *Shadow) Error() string {
+	by := "no route"
+	if s.By != "" {
+		by = fmt.Sprintf("%q", s.By)
+	}
+	return fmt.Sprintf("route %q: %s %s is handled by %s",
+		s.Route, s.Method, s.Path, by)
+}
+
+type Overlap struct {
+	Route1  string
+	Route2  string
+	Methods MethodSet
+}
+
+func (o Overlap) String() string {
+	return fmt.Sprintf("%q and %q overlap for %s", o.Route1, o.Route2, o.Methods)
+}
+
+// the methods tried for routes that take any method
+var probeMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// OK is true when no route is shadowed.
+// Overlaps alone aren't a problem.
+func (a *Analysis) OK() bool {
+	return len(a.Shadowed) == 0
+}
+
+// Err returns the shadowed routes as an Errors of *Shadow, or nil.
+func (a *Analysis) Err() error {
+	if a.OK() {
+		return nil
+	}
+	var errs Errors
+	for i := range a.Shadowed {
+		errs = append(errs, &a.Shadowed[i])
+	}
+	return errs
+}
+
+func (a *Analysis) String() string {
+	var lines []string
+	for i := range a.Shadowed {
+		lines = append(lines, "shadowed: "+a.Shadowed[i].Error())
+	}
+	for _, name := range a.Unreachable {
+		lines = append(lines, fmt.Sprintf("unreachable: %q", name))
+	}
+	for _, o := range a.Overlaps {
+		lines = append(lines, "overlap: "+o.String())
+	}
+	for _, name := range a.Skipped {
+		lines = append(lines, fmt.Sprintf("skipped: %q", name))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *RouteDef) Analyze(base *mux.Router) *Analysis {
+	return Analyze(r, base)
+}
+
+// Analyze builds the route tree into a router like the one of
+// BuildNewRouter, and sends a sample request to it for each route
+// and method, to see which route matches it. The routes of base,
+// if not nil, are tried before the tree, like the handlers that
+// are added to base before BuildRouter. Base is left as it is,
+// and should not already contain the tree.
+//
+// Only matching is checked: no handler, hook or guard is run.
+func Analyze(routeDef *RouteDef, base *mux.Router) *Analysis {
+	router := mux.NewRouter()
+	router.StrictSlash(true)
+	if base != nil {
+		router.NewRoute().MatcherFunc(matchRouter(base))
+	}
+	var matched *RouteDef
+	buildRoute(routeDef, router, func(r *RouteDef) {
+		if matched == nil {
+			matched = r
+		}
+	})
+
+	a := &Analysis{}
+	type sampled struct {
+		route *RouteDef
+		path  string
+		re    *regexp.Regexp
+	}
+	var samples []sampled
+
+	routeDef.Iter(func(r *RouteDef) {
+		if r.Handler == nil {
+			return
+		}
+		path, ok := samplePath(r.FullPath())
+		target := path
+		if host := r.FullHost(); ok && host != "" {
+			var sample string
+			sample, ok = samplePath(hostTemplate(host))
+			target = "http://" + sample + path
+		}
+		re, err := pathRegexp(r)
+		if !ok || err != nil || hasTransformer(r) {
+			a.Skipped = append(a.Skipped, routeName(r))
+			return
+		}
+		samples = append(samples, sampled{r, path, re})
+
+		methods := []string(r.EffectiveMethods())
+		if methods == nil {
+			methods = probeMethods
+		}
+		shadowed := 0
+		for _, method := range methods {
+			req, err := ht.NewRequest(method, target, nil)
+			if err != nil {
+				continue
+			}
+			matched = nil
+			var match mux.RouteMatch
+			ok := router.Match(req, &match)
+			if matched == r {
+				continue
+			}
+			shadow := Shadow{Route: routeName(r), Path: path, Method: method}
+			switch {
+			case matched != nil:
+				shadow.By = routeName(matched)
+			case ok && match.Route != nil:
+				shadow.By = muxRouteName(match.Route)
+			}
+			a.Shadowed = append(a.Shadowed, shadow)
+			shadowed++
+		}
+		if shadowed == len(methods) {
+			a.Unreachable = append(a.Unreachable, routeName(r))
+		}
+	})
+
+	for i, s1 := range samples {
+		for _, s2 := range samples[i+1:] {
+			ms := s1.route.EffectiveMethods().Intersect(s2.route.EffectiveMethods())
+			if ms != nil && len(ms) == 0 ||
+				s1.route.FullHost() != s2.route.FullHost() {
+				continue
+			}
+			if s1.re.MatchString(s2.path) || s2.re.MatchString(s1.path) {
+				a.Overlaps = append(a.Overlaps, Overlap{
+					routeName(s1.route), routeName(s2.route), ms,
+				})
+			}
+		}
+	}
+	return a
+}
+
+// matchRouter matches the requests that one of the routes of base
+// matches, with the match of base.
+func matchRouter(base *mux.Router) mux.MatcherFunc {
+	return func(req *ht.Request, match *mux.RouteMatch) bool {
+		var m mux.RouteMatch
+		if base.Match(req, &m) && m.MatchErr == nil {
+			*match = m
+			return true
+		}
+		return false
+	}
+}
+
+// probeMatcher is added last to the matchers of a route while
+// analyzing, so it is only reached when the route matches.
+// Mux still runs the matchers after a method mismatch,
+// hence the check for the method.
+func probeMatcher(r *RouteDef, probe func(*RouteDef)) mux.MatcherFunc {
+	methods := r.EffectiveMethods()
+	return func(req *ht.Request, _ *mux.RouteMatch) bool {
+		if methods.Contains(req.Method) {
+			probe(r)
+		}
+		return true
+	}
+}
+
+func hasTransformer(r *RouteDef) bool {
+	for ; r != nil; r = r.parent {
+		if r.transformer != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func routeName(r *RouteDef) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.FullPath()
+}
+
+func muxRouteName(route *mux.Route) string {
+	if name := route.GetName(); name != "" {
+		return name
+	}
+	tmpl, _ := route.GetPathTemplate()
+	return tmpl
+}
+
+// pathRegexp matches the paths a route handles: a route with
+// subroutes or an exact route handles its own path only, other
+// routes handle any path with their path as prefix.
+func pathRegexp(r *RouteDef) (*regexp.Regexp, error) {
+	parts, err := parseTemplate(r.FullPath())
+	if err != nil {
+		return nil, err
+	}
+	var s []string
+	for _, p := range parts {
+		if !p.isVar() {
+			s = append(s, regexp.QuoteMeta(p.literal))
+			continue
+		}
+		pattern := p.pattern
+		if pattern == "" {
+			pattern = "[^/]+"
+		}
+		s = append(s, "(?:"+pattern+")")
+	}
+	expr := "^" + strings.Join(s, "")
+	if len(r.subroutes) > 0 || r.IsExact() {
+		expr += "/?$"
+	}
+	return regexp.Compile(expr)
+}
+
+// samplePath makes a path that matches the template,
+// with a sample value for each variable.
+func samplePath(tmpl string) (string, bool) {
+	parts, err := parseTemplate(tmpl)
+	if err != nil {
+		return "", false
+	}
+	var s []string
+	for _, p := range parts {
+		if !p.isVar() {
+			s = append(s, p.literal)
+			continue
+		}
+		v, ok := sampleValue(p.pattern)
+		if !ok {
+			return "", false
+		}
+		s = append(s, v)
+	}
+	return strings.Join(s, ""), true
+}
+
+func sampleValue(pattern string) (string, bool) {
+	if pattern == "" {
+		pattern = "[^/]+"
+	}
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	var b strings.Builder
+	if !writeSample(&b, re.Simplify()) {
+		return "", false
+	}
+	v := b.String()
+	return v, v != "" && matchVar(pattern, v)
+}
+
+// writeSample writes the shortest string it can find that
+// matches the regexp, preferring letters and digits.
+func writeSample(b *strings.Builder, re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpStar, syntax.OpQuest,
+		syntax.OpBeginLine, syntax.OpEndLine,
+		syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return true
+	case syntax.OpLiteral:
+		b.WriteString(string(re.Rune))
+		return true
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteByte('a')
+		return true
+	case syntax.OpCharClass:
+		c, ok := sampleRune(re.Rune)
+		if ok {
+			b.WriteRune(c)
+		}
+		return ok
+	case syntax.OpCapture, syntax.OpPlus:
+		return writeSample(b, re.Sub[0])
+	case syntax.OpRepeat:
+		for i := 0; i < re.Min; i++ {
+			if !writeSample(b, re.Sub[0]) {
+				return false
+			}
+		}
+		return true
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !writeSample(b, sub) {
+				return false
+			}
+		}
+		return true
+	case syntax.OpAlternate:
+		return writeSample(b, re.Sub[0])
+	}
+	return false
+}
+
+// ranges is a list of pairs of runes, as in syntax.Regexp
+func sampleRune(ranges []rune) (rune, bool) {
+	in := func(c rune) bool {
+		for i := 0; i+1 < len(ranges); i += 2 {
+			if ranges[i] <= c && c <= ranges[i+1] {
+				return true
+			}
+		}
+		return false
+	}
+	for _, c := range "a0A-_" {
+		if in(c) {
+			return c, true
+		}
+	}
+	for i := 0; i+1 < len(ranges); i += 2 {
+		for c := ranges[i]; c <= ranges[i+1] && c < 0x80; c++ {
+			if c > ' ' && c != '/' && c != '?' && c != '#' {
+				return c, true
+			}
+		}
+	}
+	return 0, false
+}
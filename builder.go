@@ -0,0 +1,140 @@
+package roudetef
+
+import (
+	ht "net/http"
+)
+
+// RouteBuilder is the typed counterpart of Route:
+//
+//	r, err := def.NewRoute("a-path").At(def.GET("/a")).HandlerFunc(a).
+//		Guards(requireLogin).
+//		Sub(def.NewRoute("b-path").Path("/b").HandlerFunc(b)).
+//		Build()
+//
+// A RouteBuilder can be used as a subroute of another builder
+// or of Route.
+type RouteBuilder struct {
+	route     RouteDef
+	subroutes []SubRouteDef
+}
+
+func NewRoute(name string) *RouteBuilder {
+	return &RouteBuilder{route: RouteDef{Name: name}}
+}
+
+func (b *RouteBuilder) SubRouteDef() {}
+
+func (b *RouteBuilder) Path(path string) *RouteBuilder {
+	b.route.Path = path
+	return b
+}
+
+// At sets both the path and the methods, e.g. At(GET("/login"))
+func (b *RouteBuilder) At(p pathod) *RouteBuilder {
+	b.route.Path = p.path
+	b.route.methods = p.methods
+	return b
+}
+
+func (b *RouteBuilder) Methods(methods ...string) *RouteBuilder {
+	b.route.methods = methods
+	return b
+}
+
+func (b *RouteBuilder) Handler(handler ht.Handler) *RouteBuilder {
+	if h, ok := handler.(ht.HandlerFunc); ok {
+		return b.HandlerFunc(h)
+	}
+	b.route.Handler = func(w ht.ResponseWriter, r *ht.Request) {
+		handler.ServeHTTP(w, r)
+	}
+	return b
+}
+
+func (b *RouteBuilder) HandlerFunc(handler func(ht.ResponseWriter, *ht.Request)) *RouteBuilder {
+	b.route.Handler = handler
+	return b
+}
+
+// With sets the handler and the transformers from a With() value.
+func (b *RouteBuilder) With(h HandlerT) *RouteBuilder {
+	b.route.Handler = h.handler
+	return b.Transform(h.transformer)
+}
+
+func (b *RouteBuilder) Transform(ts ...Transformer) *RouteBuilder {
+	for _, t := range ts {
+		if t != nil {
+			b.route.transformer = Group(b.route.transformer, t)
+		}
+	}
+	return b
+}
+
+func (b *RouteBuilder) Hooks(hooks ...Hook) *RouteBuilder {
+	b.route.hooks = append(b.route.hooks, hooks...)
+	return b
+}
+
+func (b *RouteBuilder) Guards(guards ...Guard) *RouteBuilder {
+	b.route.guards = append(b.route.guards, guards...)
+	return b
+}
+
+// Sub adds subroutes, which may be other builders,
+// route definitions or re-routes.
+func (b *RouteBuilder) Sub(subroutes ...SubRouteDef) *RouteBuilder {
+	b.subroutes = append(b.subroutes, subroutes...)
+	return b
+}
+
+// Build creates the route definition. Unlike Route, it returns
+// an error for invalid methods, for unresolved re-routes and
+// re-route cycles, for unknown routes of versions and for the
+// errors of the subroute builders. Since a re-route may point
+// anywhere in the tree, only the root should be built.
+func (b *RouteBuilder) Build() (*RouteDef, error) {
+	var errs Errors
+	r := b.assemble()
+	r.Iter(func(r *RouteDef) {
+		for _, p := range r.unresolved {
+			errs = append(errs, &ValidationError{UnresolvedReRoute, r.Name, r.Path,
+				"destination " + p.reroute.destName + " not found"})
+		}
+		for _, problem := range r.problems {
+			errs = append(errs, problem)
+		}
+	})
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return r, nil
+}
+
+// assemble records the problems on the routes, for Build
+// and for Validate when the tree was made with Route
+func (b *RouteBuilder) assemble() *RouteDef {
+	r := b.route
+	r.Path = withParamPatterns(r.Path, r.params)
+	checkMethods(&r)
+
+	var subroutes []SubRouteDef
+	for _, sub := range b.subroutes {
+		if sb, ok := sub.(*RouteBuilder); ok {
+			sub = sb.assemble()
+		}
+		subroutes = append(subroutes, sub)
+	}
+	withSubroutes(&r, subroutes)
+	return &r
+}
+
+// checkMethods records the methods that are not valid tokens
+func checkMethods(r *RouteDef) {
+	for _, method := range r.methods {
+		if !isToken(method) {
+			r.problems = append(r.problems, &ValidationError{BadMethod, r.Name, r.Path,
+				"invalid method " + method})
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package roudetef
+
+import (
+	"context"
+	ht "net/http"
+)
+
+type routeCtxKey struct{}
+
+// MatchedRoute returns the route definition that matched the request,
+// or nil. It is available to the handlers, guard handlers and hooks
+// of routers made by BuildRouter.
+func MatchedRoute(req *ht.Request) *RouteDef {
+	r, _ := req.Context().Value(routeCtxKey{}).(*RouteDef)
+	return r
+}
+
+func (r *RouteDef) Parent() *RouteDef {
+	return r.parent
+}
+
+// Chain returns the ancestors of the route, from the root
+// down to the route itself.
+func (r *RouteDef) Chain() []*RouteDef {
+	var chain []*RouteDef
+	for ; r != nil; r = r.parent {
+		chain = append([]*RouteDef{r}, chain...)
+	}
+	return chain
+}
+
+func requestWithRoute(r *RouteDef, req *ht.Request) *ht.Request {
+	ctx := context.WithValue(req.Context(), routeCtxKey{}, r)
+	return req.WithContext(ctx)
+}
+
+func withRoute(r *RouteDef, handler ht.HandlerFunc) ht.HandlerFunc {
+	return func(w ht.ResponseWriter, req *ht.Request) {
+		handler(w, requestWithRoute(r, req))
+	}
+}
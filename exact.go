@@ -0,0 +1,36 @@
+package roudetef
+
+// Exact makes the route, and the routes under it, match their
+// path exactly instead of as a prefix, so that /logout doesn't
+// also match /logout/anything or /logoutanything.
+// Routes with subroutes still match their path as a prefix.
+// With StrictSlash, the path with a trailing slash is redirected
+// to the one without, as for any mux.Route.Path.
+//
+// Exact(false) turns it off for a subtree of an exact tree.
+func (r *RouteDef) Exact(exactOpt ...bool) *RouteDef {
+	exact := true
+	if len(exactOpt) > 0 {
+		exact = exactOpt[0]
+	}
+	r.exact = &exact
+	return r
+}
+
+func (b *RouteBuilder) Exact(exactOpt ...bool) *RouteBuilder {
+	b.route.Exact(exactOpt...)
+	return b
+}
+
+// IsExact tells if the route matches its path exactly.
+func (r *RouteDef) IsExact() bool {
+	if len(r.subroutes) > 0 {
+		return false
+	}
+	for ; r != nil; r = r.parent {
+		if r.exact != nil {
+			return *r.exact
+		}
+	}
+	return false
+}
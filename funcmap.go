@@ -0,0 +1,102 @@
+package roudetef
+
+import (
+	"errors"
+	ht "net/http"
+	"net/url"
+	"text/template"
+)
+
+// TemplateFuncs provides template functions for a route tree.
+// The URL function is created once, FuncMap is then cheap enough
+// to call for every request:
+//
+//	funcs := routeDef.TemplateFuncs()
+//	tmpl := template.Must(template.New("page").Funcs(funcs.FuncMap(nil)).Parse(page))
+//	...
+//	t, _ := tmpl.Clone()
+//	t.Funcs(funcs.FuncMap(r)).Execute(w, data)
+type TemplateFuncs struct {
+	urlfn UrlFn
+	// scheme and host for urlAbs, e.g. "https://example.com";
+	// if empty, the ones of the request are used
+	Base string
+}
+
+func (r *RouteDef) TemplateFuncs() *TemplateFuncs {
+	return &TemplateFuncs{urlfn: r.CreateUrlFn()}
+}
+
+// FuncMap is a shorthand for TemplateFuncs().FuncMap(req)
+func (r *RouteDef) FuncMap(req *ht.Request) template.FuncMap {
+	return r.TemplateFuncs().FuncMap(req)
+}
+
+// FuncMap returns the following functions, for text/template
+// or html/template:
+//
+//	url name [key value]...     the path of the named route
+//	urlAbs name [key value]...  the absolute URL of the named route
+//	routeName                   the name of the route that matched req
+//	isActive name               whether the route that matched req is
+//	                            the named route or one of its subroutes
+//
+// Errors make the template execution fail. The request may be nil,
+// e.g. when parsing, but then only url works.
+func (tf *TemplateFuncs) FuncMap(req *ht.Request) template.FuncMap {
+	matched := (*RouteDef)(nil)
+	if req != nil {
+		matched = MatchedRoute(req)
+	}
+	return template.FuncMap{
+		"url": tf.urlfn,
+		"urlAbs": func(name string, params ...string) (string, error) {
+			s, err := tf.urlfn(name, params...)
+			if err != nil {
+				return "", err
+			}
+			// the query of Queries routes is part of it
+			u, err := url.Parse(s)
+			if err != nil {
+				return "", err
+			}
+			if u.IsAbs() {
+				// routes with a host are absolute already
+				return s, nil
+			}
+			base, err := tf.base(req)
+			if err != nil {
+				return "", err
+			}
+			return base.ResolveReference(u).String(), nil
+		},
+		"routeName": func() string {
+			if matched == nil {
+				return ""
+			}
+			return matched.Name
+		},
+		"isActive": func(name string) bool {
+			for r := matched; r != nil; r = r.parent {
+				if r.Name == name {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+func (tf *TemplateFuncs) base(req *ht.Request) (*url.URL, error) {
+	if tf.Base != "" {
+		return url.Parse(tf.Base)
+	}
+	if req == nil {
+		return nil, errors.New("urlAbs needs a request or a base URL")
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return &url.URL{Scheme: scheme, Host: req.Host}, nil
+}
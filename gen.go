@@ -0,0 +1,98 @@
+package roudetef
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// GenerateURLHelpers returns the source of a Go package with one
+// URL function per named route, e.g. URLUserPath(id string) for a
+// route named user-path with the path /user/{id}. The functions call
+// the package variable UrlFor, which must be set to a UrlFn:
+//
+//	urls.UrlFor = routeDef.CreateUrlFn()
+//	path, err := urls.URLUserPath("123")
+//
+// Renaming a route then breaks the build instead of the page.
+func GenerateURLHelpers(routeDef *RouteDef, pkg string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by roudetef; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	fmt.Fprintf(&buf, "import def %q\n\n", "github.com/nvlled/roudetef")
+	fmt.Fprintf(&buf, "// UrlFor is called by the functions below.\n")
+	fmt.Fprintf(&buf, "var UrlFor def.UrlFn\n")
+
+	var errs Errors
+	funcs := make(map[string]string)
+	routeDef.Iter(func(r *RouteDef) {
+		if r.Name == "" {
+			return
+		}
+		fname := "URL" + goName(r.Name, true)
+		if other, ok := funcs[fname]; ok {
+			errs = append(errs, fmt.Errorf("routes %q and %q both map to %s",
+				other, r.Name, fname))
+			return
+		}
+		funcs[fname] = r.Name
+
+		var params, args []string
+		args = append(args, fmt.Sprintf("%q", r.Name))
+		// names like user_id and userId map to the same
+		// parameter, and UrlFor is needed in the body
+		used := map[string]bool{"UrlFor": true}
+		vars := make(map[string]bool)
+		for _, v := range templateVars(r.urlTemplate()) {
+			if vars[v.name] {
+				continue
+			}
+			vars[v.name] = true
+			p := goName(v.name, false)
+			for token.IsKeyword(p) || used[p] {
+				p += "_"
+			}
+			used[p] = true
+			params = append(params, p+" string")
+			args = append(args, fmt.Sprintf("%q", v.name), p)
+		}
+
+		fmt.Fprintf(&buf, "\n// %s returns the URL of %s (%s)\n",
+			fname, r.Name, r.urlTemplate())
+		fmt.Fprintf(&buf, "func %s(%s) (string, error) {\n", fname,
+			strings.Join(params, ", "))
+		fmt.Fprintf(&buf, "\treturn UrlFor(%s)\n}\n", strings.Join(args, ", "))
+	})
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return format.Source(buf.Bytes())
+}
+
+// goName turns a route or variable name like json/a-path
+// into an identifier like JsonAPath (or jsonAPath).
+func goName(name string, exported bool) string {
+	words := strings.FieldsFunc(name, func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+	var s []string
+	for i, w := range words {
+		if i > 0 || exported {
+			c, size := utf8.DecodeRuneInString(w)
+			w = string(unicode.ToUpper(c)) + w[size:]
+		}
+		s = append(s, w)
+	}
+	id := strings.Join(s, "")
+	if c, _ := utf8.DecodeRuneInString(id); id == "" || unicode.IsDigit(c) {
+		id = "X" + id
+		if !exported {
+			id = "x" + id[1:]
+		}
+	}
+	return id
+}
@@ -0,0 +1,135 @@
+package roudetef
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// GenerateTSRoutes returns a TypeScript module with a function per
+// named route, taking the path variables and returning the path,
+// and a routes table with the path template and allowed methods
+// of each route (null for any method).
+func GenerateTSRoutes(routeDef *RouteDef) ([]byte, error) {
+	return generateJSRoutes(routeDef, true)
+}
+
+// GenerateJSRoutes is GenerateTSRoutes without the types.
+func GenerateJSRoutes(routeDef *RouteDef) ([]byte, error) {
+	return generateJSRoutes(routeDef, false)
+}
+
+func generateJSRoutes(routeDef *RouteDef, typed bool) ([]byte, error) {
+	var buf bytes.Buffer
+	var table bytes.Buffer
+	var errs Errors
+	funcs := make(map[string]string)
+
+	ts := func(s string) string {
+		if typed {
+			return s
+		}
+		return ""
+	}
+
+	fmt.Fprintf(&buf, "// Code generated by roudetef; DO NOT EDIT.\n\n")
+	if typed {
+		fmt.Fprintf(&buf, "export type Param = string | number;\n\n")
+	}
+
+	routeDef.Iter(func(r *RouteDef) {
+		if r.Name == "" {
+			return
+		}
+		fname := goName(r.Name, false)
+		if jsReserved[fname] {
+			fname += "_"
+		}
+		if other, ok := funcs[fname]; ok {
+			errs = append(errs, fmt.Errorf("routes %q and %q both map to %s",
+				other, r.Name, fname))
+			return
+		}
+		funcs[fname] = r.Name
+
+		tmpl := r.FullPath()
+		if host := r.FullHost(); host != "" {
+			// same scheme as the page
+			tmpl = "//" + host + tmpl
+		}
+		tmpl += r.queryString()
+		parts, err := parseTemplate(tmpl)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		var params, path []string
+		// a variable can be in both the host and the path
+		vars := make(map[string]bool)
+		for _, p := range parts {
+			if !p.isVar() {
+				path = append(path, jsTemplateEscape(p.literal))
+				continue
+			}
+			key := jsString(p.name)
+			if !vars[p.name] {
+				vars[p.name] = true
+				params = append(params, key+ts(": Param"))
+			}
+			path = append(path, fmt.Sprintf("${encodeURIComponent(String(params[%s]))}", key))
+		}
+
+		arg := ""
+		if len(params) > 0 {
+			arg = "params" + ts(": { "+strings.Join(params, "; ")+" }")
+		}
+		fmt.Fprintf(&buf, "// %s\n", tmpl)
+		fmt.Fprintf(&buf, "export function %s(%s)%s {\n", fname, arg, ts(": string"))
+		fmt.Fprintf(&buf, "  return `%s`;\n}\n\n", strings.Join(path, ""))
+
+		methods := "null"
+		if ms := r.EffectiveMethods(); ms != nil {
+			quoted := []string{}
+			for _, m := range ms {
+				quoted = append(quoted, jsString(m))
+			}
+			methods = "[" + strings.Join(quoted, ", ") + "]"
+		}
+		fmt.Fprintf(&table, "  %s: { path: %s, methods: %s, url: %s },\n",
+			jsString(r.Name), jsString(r.FullPath()), methods, fname)
+	})
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	fmt.Fprintf(&buf, "export const routes = {\n%s}%s;\n", table.String(), ts(" as const"))
+	return buf.Bytes(), nil
+}
+
+// the reserved words of JavaScript, in strict mode since modules
+// are, and the names the module itself uses
+var jsReserved = func() map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.Fields(`
+		await break case catch class const continue debugger default
+		delete do else enum export extends false finally for function
+		if import in instanceof new null return super switch this throw
+		true try typeof var void while with yield let static implements
+		interface package private protected public arguments eval
+		undefined NaN Infinity routes encodeURIComponent String Param`) {
+		words[w] = true
+	}
+	return words
+}()
+
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func jsTemplateEscape(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "`", "\\`", -1)
+	return strings.Replace(s, "${", "\\${", -1)
+}
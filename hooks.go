@@ -0,0 +1,85 @@
+package roudetef
+
+import (
+	ht "net/http"
+)
+
+// A RequestHook runs right before the route handler, and unlike
+// a Hook, can replace the request (e.g. to add context values)
+// or stop it with an error. An error that is an http.Handler,
+// like *HTTPError, is used as the response; any other error
+// results in a 500.
+//
+// The request hooks of the parent routes run first.
+type RequestHook func(*ht.Request) (*ht.Request, error)
+
+type HTTPError struct {
+	Status int
+	Msg    string
+}
+
+func (e *HTTPError) Error() string {
+	return e.Msg
+}
+
+func (e *HTTPError) ServeHTTP(w ht.ResponseWriter, r *ht.Request) {
+	ht.Error(w, e.Msg, e.Status)
+}
+
+func Fail(status int, msg string) *HTTPError {
+	return &HTTPError{status, msg}
+}
+
+func RequestHooks(hooks ...RequestHook) []RequestHook {
+	return hooks
+}
+
+func (r *RouteDef) AddRequestHooks(hooks ...RequestHook) *RouteDef {
+	r.reqHooks = append(append([]RequestHook{}, r.reqHooks...), hooks...)
+	return r
+}
+
+func (b *RouteBuilder) RequestHooks(hooks ...RequestHook) *RouteBuilder {
+	b.route.AddRequestHooks(hooks...)
+	return b
+}
+
+// RequestHooks adds request hooks that only run
+// for the re-routed copy of the destination.
+func (r *ReRouteDef) RequestHooks(hooks ...RequestHook) *ReRouteDef {
+	r.reqHooks = append(r.reqHooks, hooks...)
+	return r
+}
+
+// RequestHookChain returns the request hooks of the route and its
+// ancestors, in the order they are run.
+func (r *RouteDef) RequestHookChain() []RequestHook {
+	var hooks []RequestHook
+	for _, route := range r.Chain() {
+		hooks = append(hooks, route.reqHooks...)
+	}
+	return hooks
+}
+
+func runRequestHooks(hooks []RequestHook, handler ht.HandlerFunc) ht.HandlerFunc {
+	if len(hooks) == 0 {
+		return handler
+	}
+	return func(w ht.ResponseWriter, req *ht.Request) {
+		for _, hook := range hooks {
+			req_, err := hook(req)
+			if err != nil {
+				if h, ok := err.(ht.Handler); ok {
+					h.ServeHTTP(w, req)
+				} else {
+					ht.Error(w, err.Error(), ht.StatusInternalServerError)
+				}
+				return
+			}
+			if req_ != nil {
+				req = req_
+			}
+		}
+		handler(w, req)
+	}
+}
@@ -0,0 +1,49 @@
+package roudetef
+
+// Host sets the host template of the route, e.g. "{tenant}.example.com",
+// as for mux.Route.Host. The subroutes are limited to the same host,
+// unless they have a host of their own. The URLs of a route with
+// a host are absolute.
+func (r *RouteDef) Host(tmpl string) *RouteDef {
+	r.host = tmpl
+	return r
+}
+
+func (b *RouteBuilder) Host(tmpl string) *RouteBuilder {
+	b.route.Host(tmpl)
+	return b
+}
+
+// Host sets the host of the re-routed copy of the destination,
+// to mount the same routes under another host:
+//
+//	def.SRoute("", nil, "root",
+//		def.SRoute("/", home, "site", ...).Host("www.example.com"),
+//		def.ReSRoute("", "api", "site").Host("api.example.com"),
+//	)
+func (r *ReRouteDef) Host(tmpl string) *ReRouteDef {
+	r.host = tmpl
+	return r
+}
+
+// FullHost returns the host template of the route or of its nearest
+// ancestor with one, or "" when any host is matched.
+func (r *RouteDef) FullHost() string {
+	for ; r != nil; r = r.parent {
+		if r.host != "" {
+			return r.host
+		}
+	}
+	return ""
+}
+
+// hostTemplate makes the default pattern of the variables of a host
+// template explicit, since it isn't the same as for paths.
+func hostTemplate(host string) string {
+	return explicitPatterns(host, "[^.]+")
+}
+
+// the host, path and query of the route, as shown in the route table
+func (r *RouteDef) urlTemplate() string {
+	return r.FullHost() + r.FullPath() + r.queryString()
+}
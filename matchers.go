@@ -0,0 +1,81 @@
+package roudetef
+
+import (
+	"github.com/gorilla/mux"
+	ht "net/http"
+	"net/url"
+	"strings"
+)
+
+// Queries limits a route to requests with the given query values,
+// as for mux.Route.Queries. The values are templates, so
+// Queries("type", "user") matches ?type=user only, and
+// Queries("page", "{page:[0-9]+}") any numeric page.
+//
+// The query shows in the route table, and in the URLs of the
+// route, which makes it possible to have two named routes
+// on the same path:
+//
+//	def.SRoute("/search", def.With(searchUsers, def.Queries("type", "user")), "search-users"),
+//	def.SRoute("/search", def.With(searchPosts, def.Queries("type", "post")), "search-posts"),
+func Queries(pairs ...string) Transformer {
+	return queries(pairs)
+}
+
+type queries []string
+
+func (q queries) Transform(r *mux.Route) {
+	r.Queries(q...)
+}
+
+func HeadersRegexp(pairs ...string) Transformer {
+	return TransformerFunc(func(r *mux.Route) {
+		r.HeadersRegexp(pairs...)
+	})
+}
+
+// MatcherFunc limits a route to the requests for which match is true.
+func MatcherFunc(match func(*ht.Request) bool) Transformer {
+	return TransformerFunc(func(r *mux.Route) {
+		r.MatcherFunc(func(req *ht.Request, _ *mux.RouteMatch) bool {
+			return match(req)
+		})
+	})
+}
+
+// QueryPairs returns the key and value templates of the Queries
+// of the route and its ancestors, in pairs.
+func (r *RouteDef) QueryPairs() []string {
+	var pairs []string
+	for _, route := range r.Chain() {
+		pairs = append(pairs, queryPairs(route.transformer)...)
+	}
+	return pairs
+}
+
+func queryPairs(t Transformer) []string {
+	switch t := t.(type) {
+	case queries:
+		return t
+	case group:
+		var pairs []string
+		for _, t := range t {
+			pairs = append(pairs, queryPairs(t)...)
+		}
+		return pairs
+	}
+	return nil
+}
+
+// the query part of the route table, e.g. ?type=user
+func (r *RouteDef) queryString() string {
+	pairs := r.QueryPairs()
+	var s []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		s = append(s, url.QueryEscape(pairs[i])+"="+pairs[i+1])
+	}
+	if len(s) == 0 {
+		return ""
+	}
+	return "?" + strings.Join(s, "&")
+}
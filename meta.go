@@ -0,0 +1,85 @@
+package roudetef
+
+import (
+	ht "net/http"
+)
+
+// A MetaKey attaches values of type T to route definitions.
+// Values are inherited by the subroutes, unless overridden:
+//
+//	var Owner = def.NewMetaKey[string]("owner")
+//	...
+//	def.NewRoute("a-path").Path("/a").Meta(Owner.Value("team-a"))
+//	...
+//	owner, ok := Owner.Get(routeDef.Search("b-path"))
+type MetaKey[T any] struct {
+	name string
+}
+
+// A key/value pair created by MetaKey.Value
+type MetaValue struct {
+	key   interface{}
+	value interface{}
+}
+
+func NewMetaKey[T any](name string) *MetaKey[T] {
+	return &MetaKey[T]{name}
+}
+
+func (k *MetaKey[T]) Name() string {
+	return k.name
+}
+
+func (k *MetaKey[T]) Value(v T) MetaValue {
+	return MetaValue{k, v}
+}
+
+func (k *MetaKey[T]) Set(r *RouteDef, v T) *RouteDef {
+	return r.SetMeta(k.Value(v))
+}
+
+// Get returns the value of the route, or of its nearest ancestor.
+func (k *MetaKey[T]) Get(r *RouteDef) (T, bool) {
+	for ; r != nil; r = r.parent {
+		if v, ok := r.meta[k]; ok {
+			return v.(T), true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// Own is like Get, but ignores the ancestors.
+func (k *MetaKey[T]) Own(r *RouteDef) (T, bool) {
+	v, ok := r.meta[k]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return v.(T), true
+}
+
+// Request returns the value for the route that handled the request.
+func (k *MetaKey[T]) Request(req *ht.Request) (T, bool) {
+	return k.Get(MatchedRoute(req))
+}
+
+// SetMeta sets the values on the route. The metadata is copied
+// first, so copies of the route made by Map or ReRoute aren't
+// affected.
+func (r *RouteDef) SetMeta(values ...MetaValue) *RouteDef {
+	meta := make(map[interface{}]interface{})
+	for k, v := range r.meta {
+		meta[k] = v
+	}
+	for _, mv := range values {
+		meta[mv.key] = mv.value
+	}
+	r.meta = meta
+	return r
+}
+
+func (b *RouteBuilder) Meta(values ...MetaValue) *RouteBuilder {
+	b.route.SetMeta(values...)
+	return b
+}
@@ -0,0 +1,196 @@
+package roudetef
+
+import (
+	"github.com/gorilla/mux"
+	ht "net/http"
+	"sort"
+	"strings"
+)
+
+// A MethodSet is a set of http methods. A nil MethodSet
+// stands for any method.
+type MethodSet []string
+
+func (r *RouteDef) Methods() MethodSet {
+	return MethodSet(r.methods)
+}
+
+// EffectiveMethods returns the methods the route can actually
+// match, which are limited by the methods of its parents.
+func (r *RouteDef) EffectiveMethods() MethodSet {
+	ms := r.Methods()
+	for p := r.parent; p != nil; p = p.parent {
+		ms = ms.Intersect(p.Methods())
+	}
+	return ms
+}
+
+// At creates a path argument for Route, like GET("/path") does.
+func (ms MethodSet) At(path string) pathod {
+	return Methods(ms...)(path)
+}
+
+func (ms MethodSet) Contains(method string) bool {
+	if ms == nil {
+		return true
+	}
+	for _, m := range ms {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ms MethodSet) Union(others ...MethodSet) MethodSet {
+	if ms == nil {
+		return nil
+	}
+	result := append(MethodSet{}, ms...)
+	for _, other := range others {
+		if other == nil {
+			return nil
+		}
+		for _, m := range other {
+			if !result.Contains(m) {
+				result = append(result, m)
+			}
+		}
+	}
+	return result
+}
+
+func (ms MethodSet) Intersect(other MethodSet) MethodSet {
+	if ms == nil {
+		return other
+	}
+	if other == nil {
+		return ms
+	}
+	result := MethodSet{}
+	for _, m := range ms {
+		if other.Contains(m) {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func (ms MethodSet) String() string {
+	return stringMethods(ms)
+}
+
+// addFallbacks adds, after the routes of the tree, a route for each
+// path whose routes are limited to some methods or media types. The
+// fallback route answers OPTIONS requests with the allowed methods,
+// other methods with a 405 and an Allow header, and the requests with
+// the wrong media types with a 406 or a 415. Only the path itself
+// is matched, with or without a trailing slash, and the request must
+// pass the guards the routes of the path have in common, those of
+// their nearest common ancestor.
+func addFallbacks(routeDef *RouteDef, base *mux.Router) {
+	type hostPath struct{ host, path string }
+	allowed := make(map[hostPath]MethodSet)
+	owners := make(map[hostPath]*RouteDef)
+	routes := make(map[hostPath][]*RouteDef)
+	// paths with Accept or ContentType routes
+	media := make(map[hostPath]bool)
+	// paths whose routes are all exact
+	exact := make(map[hostPath]bool)
+	var paths []hostPath
+	routeDef.Iter(func(r *RouteDef) {
+		path := hostPath{r.FullHost(), r.FullPath()}
+		routes[path] = append(routes[path], r)
+		if accepts, contentTypes := mediaMatchers(r); len(accepts)+len(contentTypes) > 0 {
+			media[path] = true
+		}
+		ms, seen := allowed[path]
+		if !seen {
+			paths = append(paths, path)
+			allowed[path] = r.EffectiveMethods()
+			owners[path] = r
+			exact[path] = r.IsExact()
+		} else {
+			owners[path] = commonAncestor(owners[path], r)
+			if ms != nil {
+				allowed[path] = ms.Union(r.EffectiveMethods())
+			}
+			exact[path] = exact[path] && r.IsExact()
+		}
+	})
+
+	// most specific path first, and paths with a host
+	// before the same paths without
+	sort.SliceStable(paths, func(i, j int) bool {
+		if len(paths[i].path) != len(paths[j].path) {
+			return len(paths[i].path) > len(paths[j].path)
+		}
+		return paths[i].host != "" && paths[j].host == ""
+	})
+
+	// the slash forms are registered as they are, without
+	// the redirects of StrictSlash
+	var fallbacks *mux.Router
+	for _, path := range paths {
+		ms := allowed[path]
+		if ms == nil && !media[path] {
+			continue
+		}
+		if fallbacks == nil {
+			fallbacks = base.NewRoute().Subrouter()
+			fallbacks.StrictSlash(false)
+		}
+		forms := []string{path.path}
+		if trimmed := strings.TrimRight(path.path, "/"); !exact[path] && trimmed != "" {
+			forms = []string{trimmed, trimmed + "/"}
+		}
+		// wrapped like the routes, so that e.g. CORS middleware
+		// sees the OPTIONS responses
+		owner := owners[path]
+		handler := runGuards(owner.GuardChain(), fallback(ms, routes[path]))
+		handler = runRequestHooks(owner.RequestHookChain(), handler)
+		handler = withRoute(owner, runMiddleware(owner.MiddlewareChain(), handler))
+		for _, form := range forms {
+			route := fallbacks.Path(form)
+			if path.host != "" {
+				route.Host(path.host)
+			}
+			route.HandlerFunc(handler)
+		}
+	}
+}
+
+func commonAncestor(r1, r2 *RouteDef) *RouteDef {
+	ancestors := make(map[*RouteDef]bool)
+	for ; r1 != nil; r1 = r1.parent {
+		ancestors[r1] = true
+	}
+	for ; r2 != nil; r2 = r2.parent {
+		if ancestors[r2] {
+			return r2
+		}
+	}
+	return nil
+}
+
+func fallback(methods MethodSet, routes []*RouteDef) ht.HandlerFunc {
+	allow := strings.Join(methods.Union(MethodSet{"OPTIONS"}), ", ")
+	return func(w ht.ResponseWriter, r *ht.Request) {
+		switch {
+		case methods.Contains(r.Method):
+			// the method is fine, something else didn't match
+			if handler := mediaFallback(routes, r); handler != nil {
+				handler(w, r)
+				return
+			}
+			ht.NotFound(w, r)
+		case r.Method == "OPTIONS":
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(ht.StatusOK)
+		default:
+			w.Header().Set("Allow", allow)
+			ht.Error(w, ht.StatusText(ht.StatusMethodNotAllowed),
+				ht.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package roudetef
+
+import (
+	ht "net/http"
+)
+
+// Middleware wraps the handler of a route. The middleware of the
+// parent routes wrap the middleware of the subroutes, and all of
+// them run before the hooks and guards of the route.
+type Middleware func(ht.Handler) ht.Handler
+
+func (r *RouteDef) Use(mws ...Middleware) *RouteDef {
+	r.middleware = append(append([]Middleware{}, r.middleware...), mws...)
+	return r
+}
+
+func (b *RouteBuilder) Use(mws ...Middleware) *RouteBuilder {
+	b.route.Use(mws...)
+	return b
+}
+
+// Use adds middleware that only wraps the re-routed
+// copy of the destination.
+func (r *ReRouteDef) Use(mws ...Middleware) *ReRouteDef {
+	r.middleware = append(r.middleware, mws...)
+	return r
+}
+
+// MiddlewareChain returns the middleware of the route and its
+// ancestors, outermost first.
+func (r *RouteDef) MiddlewareChain() []Middleware {
+	var mws []Middleware
+	for _, route := range r.Chain() {
+		mws = append(mws, route.middleware...)
+	}
+	return mws
+}
+
+func runMiddleware(mws []Middleware, handler ht.HandlerFunc) ht.HandlerFunc {
+	if len(mws) == 0 {
+		return handler
+	}
+	var h ht.Handler = handler
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h.ServeHTTP
+}
+
+// Recover is a middleware that calls onPanic when
+// the handler panics, instead of crashing the request.
+func Recover(onPanic func(w ht.ResponseWriter, r *ht.Request, err interface{})) Middleware {
+	return func(next ht.Handler) ht.Handler {
+		return ht.HandlerFunc(func(w ht.ResponseWriter, r *ht.Request) {
+			defer func() {
+				if err := recover(); err != nil {
+					onPanic(w, r, err)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
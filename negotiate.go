@@ -0,0 +1,328 @@
+package roudetef
+
+import (
+	"github.com/gorilla/mux"
+	"mime"
+	ht "net/http"
+	"strconv"
+	"strings"
+)
+
+// Accept limits a route to the requests that accept one of the
+// media types, with a q-value above 0. A request without an Accept
+// header accepts anything. When no route of the path accepts the
+// request, it gets a 406, see OnNotAcceptable.
+//
+// Since mux takes the first route that matches, routes that differ
+// only by Accept are tried in order, whatever the q-values of the
+// request. Use a Negotiator to pick the representation the client
+// prefers.
+func Accept(mediaTypes ...string) *AcceptMatcher {
+	return &AcceptMatcher{mediaTypes, notAcceptable}
+}
+
+type AcceptMatcher struct {
+	mediaTypes    []string
+	notAcceptable ht.HandlerFunc
+}
+
+func (m *AcceptMatcher) Transform(r *mux.Route) {
+	r.MatcherFunc(func(req *ht.Request, _ *mux.RouteMatch) bool {
+		return m.match(req)
+	})
+}
+
+// OnNotAcceptable replaces the 406 handler
+func (m *AcceptMatcher) OnNotAcceptable(handler ht.HandlerFunc) *AcceptMatcher {
+	m.notAcceptable = handler
+	return m
+}
+
+func (m *AcceptMatcher) match(req *ht.Request) bool {
+	accept := parseAccept(req.Header.Get("Accept"))
+	for _, mt := range m.mediaTypes {
+		if accept.quality(mt) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ContentType limits a route to the requests whose body has one
+// of the media types, which can be patterns like "text/*". When no
+// route of the path takes the body, the request gets a 415, see
+// OnUnsupportedMediaType.
+func ContentType(mediaTypes ...string) *ContentTypeMatcher {
+	return &ContentTypeMatcher{mediaTypes, unsupportedMediaType}
+}
+
+type ContentTypeMatcher struct {
+	mediaTypes  []string
+	unsupported ht.HandlerFunc
+}
+
+func (m *ContentTypeMatcher) Transform(r *mux.Route) {
+	r.MatcherFunc(func(req *ht.Request, _ *mux.RouteMatch) bool {
+		return hasContentType(req, m.mediaTypes)
+	})
+}
+
+// OnUnsupportedMediaType replaces the 415 handler
+func (m *ContentTypeMatcher) OnUnsupportedMediaType(handler ht.HandlerFunc) *ContentTypeMatcher {
+	m.unsupported = handler
+	return m
+}
+
+// mediaFallback returns the handler of the response to a request that
+// has the method of some of the routes of a path, but none of their
+// media types: a 406 if a route takes the body of the request, a 415
+// otherwise. It returns nil when a route takes the media types, as the
+// request was turned down for something else.
+func mediaFallback(routes []*RouteDef, req *ht.Request) ht.HandlerFunc {
+	var notAcceptable, unsupported ht.HandlerFunc
+	for _, r := range routes {
+		if !r.EffectiveMethods().Contains(req.Method) {
+			continue
+		}
+		accepts, contentTypes := mediaMatchers(r)
+		ok := true
+		for _, m := range contentTypes {
+			if !hasContentType(req, m.mediaTypes) {
+				ok = false
+				if unsupported == nil {
+					unsupported = m.unsupported
+				}
+			}
+		}
+		if !ok {
+			continue
+		}
+		for _, m := range accepts {
+			if !m.match(req) {
+				ok = false
+				if notAcceptable == nil {
+					notAcceptable = m.notAcceptable
+				}
+			}
+		}
+		if ok {
+			return nil
+		}
+	}
+	if notAcceptable != nil {
+		return notAcceptable
+	}
+	return unsupported
+}
+
+// mediaMatchers returns the Accept and ContentType transformers
+// of the route and its ancestors
+func mediaMatchers(r *RouteDef) ([]*AcceptMatcher, []*ContentTypeMatcher) {
+	var accepts []*AcceptMatcher
+	var contentTypes []*ContentTypeMatcher
+	var find func(t Transformer)
+	find = func(t Transformer) {
+		switch t := t.(type) {
+		case *AcceptMatcher:
+			accepts = append(accepts, t)
+		case *ContentTypeMatcher:
+			contentTypes = append(contentTypes, t)
+		case group:
+			for _, t := range t {
+				find(t)
+			}
+		case Ts:
+			for _, t := range t {
+				find(t)
+			}
+		}
+	}
+	for _, route := range r.Chain() {
+		find(route.transformer)
+	}
+	return accepts, contentTypes
+}
+
+func notAcceptable(w ht.ResponseWriter, r *ht.Request) {
+	ht.Error(w, ht.StatusText(ht.StatusNotAcceptable), ht.StatusNotAcceptable)
+}
+
+func unsupportedMediaType(w ht.ResponseWriter, r *ht.Request) {
+	ht.Error(w, ht.StatusText(ht.StatusUnsupportedMediaType),
+		ht.StatusUnsupportedMediaType)
+}
+
+// A Representation is the handler of a route for a media type.
+type Representation struct {
+	MediaType string
+	Handler   ht.HandlerFunc
+}
+
+func As(mediaType string, handler ht.HandlerFunc) Representation {
+	return Representation{mediaType, handler}
+}
+
+// A Negotiator is a handler that serves the representation
+// the request prefers, by the q-values of its Accept header.
+// When the client likes several of them as much, the first
+// one wins. The Content-Type of the response is set to the
+// media type of the representation, and can be changed by
+// its handler.
+//
+//	def.SRoute("/user/{id}", def.Negotiate(
+//		def.As("text/html", userPage),
+//		def.As("application/json", userJSON),
+//	).Consumes("application/json"), "user-path")
+//
+// The request gets a 406 when it accepts none of the
+// representations, and a 415 when its Content-Type is not
+// one of those set by Consumes.
+type Negotiator struct {
+	reps          []Representation
+	consumes      []string
+	notAcceptable ht.HandlerFunc
+	unsupported   ht.HandlerFunc
+}
+
+func Negotiate(reps ...Representation) *Negotiator {
+	return &Negotiator{
+		reps:          reps,
+		notAcceptable: notAcceptable,
+		unsupported:   unsupportedMediaType,
+	}
+}
+
+// Consumes sets the media types of the request bodies
+// the route handles. Requests without a body always pass.
+func (n *Negotiator) Consumes(mediaTypes ...string) *Negotiator {
+	n.consumes = mediaTypes
+	return n
+}
+
+// OnNotAcceptable replaces the 406 handler
+func (n *Negotiator) OnNotAcceptable(handler ht.HandlerFunc) *Negotiator {
+	n.notAcceptable = handler
+	return n
+}
+
+// OnUnsupportedMediaType replaces the 415 handler
+func (n *Negotiator) OnUnsupportedMediaType(handler ht.HandlerFunc) *Negotiator {
+	n.unsupported = handler
+	return n
+}
+
+func (n *Negotiator) MediaTypes() []string {
+	var mts []string
+	for _, rep := range n.reps {
+		mts = append(mts, rep.MediaType)
+	}
+	return mts
+}
+
+func (n *Negotiator) ServeHTTP(w ht.ResponseWriter, r *ht.Request) {
+	if len(n.consumes) > 0 && hasBody(r) && !hasContentType(r, n.consumes) {
+		n.unsupported(w, r)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+	rep, ok := n.choose(r)
+	if !ok {
+		n.notAcceptable(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", rep.MediaType)
+	rep.Handler(w, r)
+}
+
+func (n *Negotiator) choose(r *ht.Request) (Representation, bool) {
+	accept := parseAccept(r.Header.Get("Accept"))
+	var best Representation
+	bestQ := 0.0
+	for _, rep := range n.reps {
+		if q := accept.quality(rep.MediaType); q > bestQ {
+			best, bestQ = rep, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// a media range of an Accept header
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+type acceptHeader []mediaRange
+
+func parseAccept(header string) acceptHeader {
+	if strings.TrimSpace(header) == "" {
+		return acceptHeader{{"*", "*", 1}}
+	}
+	var accept acceptHeader
+	for _, s := range strings.Split(header, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(s))
+		if err != nil {
+			continue
+		}
+		typ, subtype := splitMediaType(mt)
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+				q = f
+			}
+		}
+		accept = append(accept, mediaRange{typ, subtype, q})
+	}
+	return accept
+}
+
+// quality is the q-value of the most specific range
+// that matches the media type, or 0 if none does.
+func (accept acceptHeader) quality(mediaType string) float64 {
+	typ, subtype := splitMediaType(mediaType)
+	q, specificity := 0.0, -1
+	for _, mr := range accept {
+		s := -1
+		switch {
+		case mr.typ == typ && mr.subtype == subtype:
+			s = 2
+		case mr.typ == typ && mr.subtype == "*":
+			s = 1
+		case mr.typ == "*" && mr.subtype == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = mr.q, s
+		}
+	}
+	return q
+}
+
+func splitMediaType(mt string) (string, string) {
+	mt = strings.ToLower(mt)
+	if i := strings.Index(mt, "/"); i >= 0 {
+		return mt[:i], mt[i+1:]
+	}
+	return mt, ""
+}
+
+// patterns are media types, or like "text/*" or "*/*"
+func hasContentType(r *ht.Request, patterns []string) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	typ, subtype := splitMediaType(mt)
+	for _, p := range patterns {
+		ptyp, psubtype := splitMediaType(p)
+		if (ptyp == "*" || ptyp == typ) && (psubtype == "*" || psubtype == subtype) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasBody(r *ht.Request) bool {
+	return r.ContentLength > 0 || r.ContentLength == -1 ||
+		r.Header.Get("Content-Type") != ""
+}
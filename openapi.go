@@ -0,0 +1,182 @@
+package roudetef
+
+import (
+	"strings"
+)
+
+// The subset of OpenAPI 3 that can be derived from a route tree.
+// Schemas are left as plain maps.
+
+type APIDoc struct {
+	OpenAPI string                              `json:"openapi"`
+	Info    APIInfo                             `json:"info"`
+	Paths   map[string]map[string]*APIOperation `json:"paths"`
+}
+
+type APIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type APIOperation struct {
+	OperationID string                  `json:"operationId,omitempty"`
+	Summary     string                  `json:"summary,omitempty"`
+	Description string                  `json:"description,omitempty"`
+	Tags        []string                `json:"tags,omitempty"`
+	Parameters  []APIParameter          `json:"parameters,omitempty"`
+	RequestBody *APIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*APIResponse `json:"responses"`
+}
+
+type APIParameter struct {
+	Name        string    `json:"name"`
+	In          string    `json:"in"`
+	Description string    `json:"description,omitempty"`
+	Required    bool      `json:"required"`
+	Schema      APISchema `json:"schema,omitempty"`
+}
+
+type APIRequestBody struct {
+	Description string                  `json:"description,omitempty"`
+	Required    bool                    `json:"required,omitempty"`
+	Content     map[string]APIMediaType `json:"content"`
+}
+
+type APIResponse struct {
+	Description string                  `json:"description"`
+	Content     map[string]APIMediaType `json:"content,omitempty"`
+}
+
+type APIMediaType struct {
+	Schema APISchema `json:"schema,omitempty"`
+}
+
+type APISchema map[string]interface{}
+
+type APIOptions struct {
+	Title   string
+	Version string
+	// methods documented for routes that match any method,
+	// defaults to GET
+	AnyMethods []string
+}
+
+// Describe attaches documentation to the route. The operationId
+// and the path parameters are filled in by OpenAPI, parameters
+// given here replace the generated ones of the same name.
+func (r *RouteDef) Describe(op APIOperation) *RouteDef {
+	r.apiOp = &op
+	return r
+}
+
+func (b *RouteBuilder) Describe(op APIOperation) *RouteBuilder {
+	b.route.apiOp = &op
+	return b
+}
+
+func (r *RouteDef) OpenAPI(opts APIOptions) *APIDoc {
+	return OpenAPI(r, opts)
+}
+
+// OpenAPI creates an OpenAPI 3 document with an operation for each
+// method of each route that has a handler. The route name is used
+// as the operationId, suffixed by the method if the route has several.
+func OpenAPI(routeDef *RouteDef, opts APIOptions) *APIDoc {
+	anyMethods := opts.AnyMethods
+	if len(anyMethods) == 0 {
+		anyMethods = []string{"GET"}
+	}
+	doc := &APIDoc{
+		OpenAPI: "3.0.3",
+		Info:    APIInfo{opts.Title, opts.Version},
+		Paths:   make(map[string]map[string]*APIOperation),
+	}
+
+	routeDef.Iter(func(r *RouteDef) {
+		if r.Handler == nil {
+			return
+		}
+		methods := r.EffectiveMethods()
+		if methods == nil {
+			methods = anyMethods
+		}
+
+		path, params := apiPath(r.FullPath())
+		item := doc.Paths[path]
+		if item == nil {
+			item = make(map[string]*APIOperation)
+			doc.Paths[path] = item
+		}
+
+		for _, method := range methods {
+			op := r.apiOperation(params)
+			if r.Name != "" {
+				op.OperationID = r.Name
+				if len(methods) > 1 {
+					op.OperationID += "-" + strings.ToLower(method)
+				}
+			}
+			item[strings.ToLower(method)] = op
+		}
+	})
+	return doc
+}
+
+func (r *RouteDef) apiOperation(params []APIParameter) *APIOperation {
+	var op APIOperation
+	if r.apiOp != nil {
+		op = *r.apiOp
+	}
+
+	var ps []APIParameter
+	for _, p := range params {
+		for _, given := range op.Parameters {
+			if given.In == "path" && given.Name == p.Name {
+				p = given
+			}
+		}
+		ps = append(ps, p)
+	}
+	for _, given := range op.Parameters {
+		if given.In != "path" {
+			ps = append(ps, given)
+		}
+	}
+	op.Parameters = ps
+
+	if len(op.Responses) == 0 {
+		op.Responses = map[string]*APIResponse{
+			"default": &APIResponse{Description: "OK"},
+		}
+	}
+	return &op
+}
+
+// apiPath converts a mux template into an OpenAPI path,
+// {id:[0-9]+} becomes {id} with a pattern in the parameter schema.
+func apiPath(tmpl string) (string, []APIParameter) {
+	parts, err := parseTemplate(tmpl)
+	if err != nil {
+		return tmpl, nil
+	}
+	var path []string
+	var params []APIParameter
+	for _, p := range parts {
+		if !p.isVar() {
+			path = append(path, p.literal)
+			continue
+		}
+		path = append(path, "{"+p.name+"}")
+		schema := APISchema{"type": "string"}
+		if p.pattern != "" {
+			schema["pattern"] = "^" + p.pattern + "$"
+		}
+		params = append(params, APIParameter{
+			Name:     p.name,
+			In:       "path",
+			Required: true,
+			Schema:   schema,
+		})
+	}
+	return strings.Join(path, ""), params
+}
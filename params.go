@@ -0,0 +1,210 @@
+package roudetef
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	ht "net/http"
+	"strconv"
+	"strings"
+)
+
+// ParamDef is a declared path variable, see Param.
+type ParamDef interface {
+	Name() string
+	Pattern() string
+	// loose params aren't added to the path template
+	isLoose() bool
+	// v is either the string form or a value of the param type
+	check(v interface{}) error
+}
+
+// A Param declares the type of a path variable of a route:
+//
+//	var UserID = def.IntParam("id")
+//	...
+//	def.NewRoute("user-path").Path("/user/{id}").Params(UserID)
+//	...
+//	id, err := UserID.Get(r) // id is an int
+//
+// The pattern of the param is added to the path template, so a
+// request with a malformed value is a 404. Values that match the
+// pattern but can't be parsed (e.g. an int out of range) are
+// passed to the ParamErrorHandler of the route, by default a 400.
+// A Loose param isn't added to the template, so malformed values
+// are passed to the ParamErrorHandler as well.
+type Param[T any] struct {
+	name    string
+	pattern string
+	parse   func(string) (T, error)
+	loose   bool
+}
+
+type ParamError struct {
+	Name  string
+	Value string
+	Err   error
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("invalid value %q for %s: %v", e.Value, e.Name, e.Err)
+}
+
+type ParamErrorHandler func(w ht.ResponseWriter, r *ht.Request, err *ParamError)
+
+func NewParam[T any](name, pattern string, parse func(string) (T, error)) *Param[T] {
+	return &Param[T]{name: name, pattern: pattern, parse: parse}
+}
+
+func IntParam(name string) *Param[int] {
+	return NewParam(name, "-?[0-9]+", strconv.Atoi)
+}
+
+func UUIDParam(name string) *Param[string] {
+	return RegexParam(name,
+		"[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}")
+}
+
+func SlugParam(name string) *Param[string] {
+	return RegexParam(name, "[a-z0-9]+(?:-[a-z0-9]+)*")
+}
+
+func RegexParam(name, pattern string) *Param[string] {
+	return NewParam(name, pattern, func(s string) (string, error) {
+		return s, nil
+	})
+}
+
+func (p *Param[T]) Name() string {
+	return p.name
+}
+
+func (p *Param[T]) Pattern() string {
+	return p.pattern
+}
+
+func (p *Param[T]) Loose() *Param[T] {
+	p_ := *p
+	p_.loose = true
+	return &p_
+}
+
+func (p *Param[T]) isLoose() bool {
+	return p.loose
+}
+
+// Parse checks s against the pattern, then parses it.
+func (p *Param[T]) Parse(s string) (T, error) {
+	var zero T
+	if !matchVar(p.pattern, s) {
+		return zero, &ParamError{p.name, s, fmt.Errorf("doesn't match %s", p.pattern)}
+	}
+	v, err := p.parse(s)
+	if err != nil {
+		return zero, &ParamError{p.name, s, err}
+	}
+	return v, nil
+}
+
+// Get returns the value of the param for the request.
+func (p *Param[T]) Get(r *ht.Request) (T, error) {
+	s, ok := mux.Vars(r)[p.name]
+	if !ok {
+		var zero T
+		return zero, &ParamError{p.name, "", fmt.Errorf("not in the route")}
+	}
+	return p.Parse(s)
+}
+
+func (p *Param[T]) check(v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		_, err := p.Parse(v)
+		return err
+	case T:
+		return nil
+	}
+	var zero T
+	return &ParamError{p.name, fmt.Sprint(v),
+		fmt.Errorf("%T given, %T expected", v, zero)}
+}
+
+func (b *RouteBuilder) Params(params ...ParamDef) *RouteBuilder {
+	b.route.params = append(b.route.params, params...)
+	return b
+}
+
+// OnParamError sets the handler for invalid params, for the
+// route and its subroutes.
+func (b *RouteBuilder) OnParamError(handler ParamErrorHandler) *RouteBuilder {
+	b.route.paramErr = handler
+	return b
+}
+
+// ParamChain returns the params declared by the route and its ancestors.
+func (r *RouteDef) ParamChain() []ParamDef {
+	var params []ParamDef
+	for _, route := range r.Chain() {
+		params = append(params, route.params...)
+	}
+	return params
+}
+
+func (r *RouteDef) paramErrorHandler() ParamErrorHandler {
+	for ; r != nil; r = r.parent {
+		if r.paramErr != nil {
+			return r.paramErr
+		}
+	}
+	return func(w ht.ResponseWriter, r *ht.Request, err *ParamError) {
+		ht.Error(w, err.Error(), ht.StatusBadRequest)
+	}
+}
+
+// withParamPatterns adds the patterns of the params to the
+// variables of the path that have none, {id} becomes {id:[0-9]+}
+func withParamPatterns(path string, params []ParamDef) string {
+	parts, err := parseTemplate(path)
+	if err != nil {
+		return path
+	}
+	var s []string
+	for _, p := range parts {
+		if !p.isVar() {
+			s = append(s, p.literal)
+			continue
+		}
+		pattern := p.pattern
+		for _, param := range params {
+			if param.Name() == p.name && pattern == "" && !param.isLoose() {
+				pattern = param.Pattern()
+			}
+		}
+		if pattern == "" {
+			s = append(s, "{"+p.name+"}")
+		} else {
+			s = append(s, "{"+p.name+":"+pattern+"}")
+		}
+	}
+	return strings.Join(s, "")
+}
+
+func checkParams(params []ParamDef, onError ParamErrorHandler,
+	handler ht.HandlerFunc) ht.HandlerFunc {
+	if len(params) == 0 {
+		return handler
+	}
+	return func(w ht.ResponseWriter, r *ht.Request) {
+		vars := mux.Vars(r)
+		for _, p := range params {
+			v, ok := vars[p.Name()]
+			if !ok {
+				continue
+			}
+			if err := p.check(v); err != nil {
+				onError(w, r, err.(*ParamError))
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
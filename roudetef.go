@@ -6,16 +6,13 @@ import (
 	"github.com/gorilla/mux"
 	"math"
 	ht "net/http"
-	"net/url"
 	"path/filepath"
 	"strings"
 )
 
 // TODO:
-// Add accept (in addition to reject) on guards
 // Interchange order of route name and transformer arguments
 // Remove API leaks
-// Allow route def serialization
 
 // code convention note:
 // Since quotes aren't allowed in identifiers,
@@ -34,11 +31,30 @@ type Entry struct {
 	Methods string
 }
 
+// A guard either rejects a request, in which case its Handler
+// is run instead of the route handler, or accepts it, in which
+// case the remaining guards are skipped. A guard that does
+// neither lets the request through to the next guard.
 type Guard struct {
+	Name    string
 	Reject  func(*ht.Request) bool
+	Accept  func(*ht.Request) bool
 	Handler ht.HandlerFunc
 }
 
+type GuardResult int
+
+const (
+	GuardPassed GuardResult = iota
+	GuardRejected
+	GuardAccepted
+)
+
+type GuardStep struct {
+	Name   string
+	Result GuardResult
+}
+
 type pathod struct {
 	path    string
 	methods []string
@@ -59,8 +75,36 @@ type RouteDef struct {
 	transformer Transformer
 	guards      []Guard
 	hooks       []Hook
-	parent      *RouteDef
-	subroutes   []*RouteDef
+	reqHooks    []RequestHook
+	middleware  []Middleware
+	params      []ParamDef
+	paramErr    ParamErrorHandler
+	// nil when inherited from the parent, see Exact
+	exact     *bool
+	slash     SlashPolicy
+	host      string
+	parent    *RouteDef
+	subroutes []*RouteDef
+
+	// set when the route is the expansion of a ReRouteDef
+	reroute *ReRouteDef
+	// the destination the route was copied from
+	origin *RouteDef
+	// re-routes whose destination wasn't found yet
+	unresolved []pendingReRoute
+	// the routes of the tree with re-routes to resolve,
+	// kept by the root, see resolveReRoutes
+	waiting []waitingRoute
+	// set when the route is the copy of the destination of a version
+	version *VersionDef
+	// problems found while building the tree, reported by Validate
+	problems []*ValidationError
+	// documentation for the OpenAPI export
+	apiOp *APIOperation
+	// never modified in place, see SetMeta
+	meta map[interface{}]interface{}
+	// registry names, set when the route is loaded from a spec
+	refs *refs
 }
 
 type ReRouteDef struct {
@@ -69,6 +113,30 @@ type ReRouteDef struct {
 	namePrefix string
 	guards     []Guard
 	hooks      []Hook
+	reqHooks   []RequestHook
+	middleware []Middleware
+	host       string
+	// the tree the destination is searched in, see From
+	tree *RouteDef
+	// set once the re-route was reported as a cycle,
+	// so the copies of the re-route don't report it again
+	cycle bool
+	refs  *refs
+}
+
+// a re-route waiting for its destination, pos being
+// where the copy goes in the subroutes
+type pendingReRoute struct {
+	reroute *ReRouteDef
+	version *VersionDef
+	pos     int
+}
+
+// a route with pending re-routes, and the highest route
+// whose subroutes were already searched, or nil
+type waitingRoute struct {
+	route    *RouteDef
+	searched *RouteDef
 }
 
 // solution for safely emulating union/variant types
@@ -85,6 +153,9 @@ func (r *RouteDef) AddTransformer(t Transformer) Transformer {
 	return t2
 }
 
+// Attach and Ward add hooks and guards to a mux route as matchers,
+// which run whenever mux tries the route, even if it ends up not
+// matching. BuildRouter doesn't use them.
 func Attach(r *mux.Route, hook Hook) {
 	r.MatcherFunc(func(r *ht.Request, m *mux.RouteMatch) bool {
 		hook(r)
@@ -94,73 +165,94 @@ func Attach(r *mux.Route, hook Hook) {
 
 func Ward(r *mux.Route, guards ...Guard) {
 	r.MatcherFunc(func(r *ht.Request, m *mux.RouteMatch) bool {
-		for _, g := range guards {
-			if g.Reject(r) {
-				m.Handler = g.Handler
-				break
-			}
+		if handler, _ := CheckGuards(r, guards...); handler != nil {
+			m.Handler = handler
 		}
 		return true
 	})
 }
 
+// CheckGuards runs the guards from left to right and returns
+// the handler of the rejecting guard, or nil if the request
+// passed or was accepted. The steps taken are returned as well.
+func CheckGuards(r *ht.Request, guards ...Guard) (ht.HandlerFunc, []GuardStep) {
+	var steps []GuardStep
+	for _, g := range guards {
+		if g.Accept != nil && g.Accept(r) {
+			steps = append(steps, GuardStep{g.Name, GuardAccepted})
+			return nil, steps
+		}
+		if g.Reject != nil && g.Reject(r) {
+			steps = append(steps, GuardStep{g.Name, GuardRejected})
+			return g.Handler, steps
+		}
+		steps = append(steps, GuardStep{g.Name, GuardPassed})
+	}
+	return nil, steps
+}
+
 func Guards(guards ...Guard) []Guard {
 	return guards
 }
 
+func AcceptIf(accept func(*ht.Request) bool) Guard {
+	return Guard{Accept: accept}
+}
+
+func RejectIf(reject func(*ht.Request) bool, handler ht.HandlerFunc) Guard {
+	return Guard{Reject: reject, Handler: handler}
+}
+
 func Hooks(hooks ...Hook) []Hook {
 	return hooks
 }
 
+// Route is the untyped shorthand for NewRoute. It panics when
+// pathmethod or handlerT is of the wrong type.
 func Route(pathmethod interface{}, handlerT interface{}, name string, hooks []Hook,
 	guards []Guard, subroutes ...SubRouteDef) *RouteDef {
 
-	var path string
-	var methods []string
+	b := NewRoute(name).Hooks(hooks...).Guards(guards...).Sub(subroutes...)
+
 	switch t := pathmethod.(type) {
 	case string:
-		path = t
+		b.Path(t)
 	case pathod:
-		{
-			path = t.path
-			methods = t.methods
-		}
+		b.At(t)
 	default:
 		panic("Invalid path argument")
 	}
 
-	var handler ht.HandlerFunc
-	var transformer Transformer
 	switch t := handlerT.(type) {
+	case nil:
+		// grouping route, no handler of its own
 	case ht.Handler:
-		handler = func(w ht.ResponseWriter, r *ht.Request) {
-			t.ServeHTTP(w, r)
-		}
+		b.Handler(t)
 	case func(ht.ResponseWriter, *ht.Request):
-		handler = t
+		b.HandlerFunc(t)
 	case HandlerT:
-		{
-			handler = t.handler
-			transformer = t.transformer
-		}
+		b.With(t)
 	default:
 		panic("Invalid handlerT argument")
 	}
 
-	r := &RouteDef{
-		Path:        path,
-		methods:     methods,
-		Handler:     handler,
-		transformer: transformer,
-		Name:        name,
-		hooks:       hooks,
-		guards:      guards,
-	}
+	// problems other than the argument types are left to Validate
+	return b.assemble()
+}
+
+func withSubroutes(r *RouteDef, subroutes []SubRouteDef) *RouteDef {
 	r.subroutes = expandReRoutes(r, subroutes)
 
+	var waiting []waitingRoute
+	if len(r.unresolved) > 0 {
+		waiting = append(waiting, waitingRoute{r, nil})
+	}
 	for _, sub := range r.subroutes {
 		sub.parent = r
+		waiting = append(waiting, sub.waiting...)
+		sub.waiting = nil
 	}
+	r.waiting = resolveReRoutes(r, waiting)
 	return r
 }
 
@@ -184,6 +276,13 @@ func ReSRoute(pathPrefix string, namePrefix string, destName string) *ReRouteDef
 	return ReRoute(pathPrefix, namePrefix, destName, Hooks(), Guards())
 }
 
+// From makes the re-route copy the destination from another tree,
+// instead of looking for it around the re-route.
+func (r *ReRouteDef) From(tree *RouteDef) *ReRouteDef {
+	r.tree = tree
+	return r
+}
+
 func (r *RouteDef) Search(name string) *RouteDef {
 	return SearchRoute(r, name)
 }
@@ -234,10 +333,16 @@ func IterRoute(r *RouteDef, f func(r *RouteDef)) *RouteDef {
 }
 
 func MapRoute(r *RouteDef, f func(r RouteDef) RouteDef) *RouteDef {
+	r_ := mapRoute(r, f)
+	r_.waiting = collectWaiting(r_)
+	return r_
+}
+
+func mapRoute(r *RouteDef, f func(r RouteDef) RouteDef) *RouteDef {
 	r_ := f(*r) // nil exception?
 	var subroutes []*RouteDef
 	for _, sub := range r_.subroutes {
-		sub := MapRoute(sub, f)
+		sub := mapRoute(sub, f)
 		sub.parent = &r_
 		subroutes = append(subroutes, sub)
 	}
@@ -246,80 +351,247 @@ func MapRoute(r *RouteDef, f func(r RouteDef) RouteDef) *RouteDef {
 }
 
 func BuildRouter(routeDef *RouteDef, base *mux.Router) *mux.Router {
-	route := base.PathPrefix(routeDef.Path).Name(routeDef.Name)
+	buildRoute(routeDef, base, nil)
+	addFallbacks(routeDef, base)
+	return base
+}
 
-	for _, hook := range routeDef.hooks {
-		Attach(route, hook)
+// probe is only set by Analyze, see probeMatcher
+func buildRoute(routeDef *RouteDef, base *mux.Router, probe func(*RouteDef)) {
+	// From the outside in: middleware, params check, hooks,
+	// request hooks, guards, then the route handler. Guards
+	// come after the request hooks to see what they loaded.
+	// Hooks and guards are run by the handler, and not by
+	// matchers, so that they run only for the route that
+	// matched, and only once. The handlers set by transformers,
+	// like H, are wrapped the same way.
+	wrap := func(handler ht.HandlerFunc) ht.HandlerFunc {
+		handler = runGuards(routeDef.GuardChain(), handler)
+		handler = runRequestHooks(routeDef.RequestHookChain(), handler)
+		handler = runHooks(routeDef.HookChain(), handler)
+		handler = checkParams(routeDef.ParamChain(),
+			routeDef.paramErrorHandler(), handler)
+		handler = runMiddleware(routeDef.MiddlewareChain(), handler)
+		return withRoute(routeDef, handler)
+	}
+	handler := routeDef.Handler
+	if handler != nil {
+		handler = wrap(handler)
 	}
 
-	Ward(route, routeDef.guards...)
-
-	if routeDef.Handler != nil {
-		route.HandlerFunc(routeDef.Handler)
+	path, other := routeDef.slashForms()
+	subroutes := routeDef.subroutes
+	// A route with subroutes, or with a slash policy of its own,
+	// is matched by a subrouter, where the policy replaces
+	// StrictSlash from here on.
+	nested := len(subroutes) > 0 || routeDef.slash != SlashDefault
+	leaf := len(subroutes) == 0
+	var route *mux.Route
+	switch {
+	case nested && other != "":
+		// the path of the route itself is matched by
+		// the subrouter, in both forms
+		route = base.PathPrefix(strings.TrimRight(path, "/"))
+	case nested:
+		route = base.PathPrefix(path)
+	case routeDef.IsExact():
+		if handler != nil {
+			addSlashForm(base, routeDef, other, handler, wrap)
+		}
+		route = base.Path(path)
+	default:
+		if handler != nil {
+			addSlashForm(base, routeDef, other, handler, wrap)
+		}
+		route = base.PathPrefix(path)
+	}
+	// the route itself is matched by an inner route of the subrouter
+	hasInner := nested && (handler != nil || leaf && routeDef.transformer != nil)
+	if !hasInner || other == "" {
+		route.Name(routeDef.Name)
+	}
+	if routeDef.host != "" {
+		route.Host(routeDef.host)
 	}
 	if routeDef.methods != nil {
 		route.Methods(routeDef.methods...)
 	}
 
-	t := routeDef.transformer
-	if t != nil {
-		t.Transform(route)
+	// A handler set by the transformer takes over. The transformer
+	// is applied before the subrouter is added, so that mux checks
+	// its matchers first, except for a leaf with a policy of its own,
+	// where it goes with the handler on the inner route.
+	transformInner := nested && leaf
+	if t := routeDef.transformer; t != nil && !transformInner {
+		transform(t, route, routeDef.SlashPolicy(), routeDef.endsWithSlash(), wrap)
+	}
+	if handler != nil && !transformInner && route.GetHandler() == nil {
+		route.HandlerFunc(handler)
+	}
+	if probe != nil && handler != nil && !nested {
+		route.MatcherFunc(probeMatcher(routeDef, probe))
+	}
+	if !nested {
+		return
 	}
 
-	subroutes := routeDef.subroutes
-	if len(subroutes) > 0 {
-		// The handler func for a path prefix
-		// fails when subrouter is called.
-		// Call subrouter() only when there are no
-		// subroutes.
-		router := route.Subrouter()
-		if routeDef.Handler != nil {
-			router.HandleFunc("/", routeDef.Handler)
+	// The handler func for a path prefix
+	// fails when subrouter is called.
+	// Call subrouter() only when there are no
+	// subroutes.
+	router := route.Subrouter()
+	if routeDef.slash != SlashDefault {
+		router.StrictSlash(false)
+	}
+	if hasInner {
+		innerPath := "/"
+		if other != "" {
+			innerOther := "/"
+			innerPath = ""
+			if strings.HasSuffix(path, "/") {
+				innerPath, innerOther = innerOther, innerPath
+			}
+			addSlashForm(router, routeDef, innerOther, handler, wrap)
+		}
+		var inner *mux.Route
+		if leaf && !routeDef.IsExact() {
+			inner = router.PathPrefix(innerPath)
+		} else {
+			inner = router.Path(innerPath)
+		}
+		if other != "" {
+			inner.Name(routeDef.Name)
+		}
+		if t := routeDef.transformer; t != nil && transformInner {
+			transform(t, inner, routeDef.SlashPolicy(), routeDef.endsWithSlash(), wrap)
+		}
+		if handler != nil && inner.GetHandler() == nil {
+			inner.HandlerFunc(handler)
 		}
-		for _, subroute := range routeDef.subroutes {
-			BuildRouter(subroute, router)
+		if probe != nil && handler != nil {
+			inner.MatcherFunc(probeMatcher(routeDef, probe))
 		}
 	}
-	return base
+	for _, subroute := range subroutes {
+		buildRoute(subroute, router, probe)
+	}
+}
+
+// HookChain returns the hooks of the route and its ancestors,
+// in the order they are run: from the root down to the route.
+func (r *RouteDef) HookChain() []Hook {
+	var hooks []Hook
+	for _, route := range r.Chain() {
+		hooks = append(hooks, route.hooks...)
+	}
+	return hooks
+}
+
+func runHooks(hooks []Hook, handler ht.HandlerFunc) ht.HandlerFunc {
+	if len(hooks) == 0 {
+		return handler
+	}
+	return func(w ht.ResponseWriter, r *ht.Request) {
+		for _, hook := range hooks {
+			hook(r)
+		}
+		handler(w, r)
+	}
+}
+
+func runGuards(guards []Guard, handler ht.HandlerFunc) ht.HandlerFunc {
+	if len(guards) == 0 {
+		return handler
+	}
+	return func(w ht.ResponseWriter, r *ht.Request) {
+		if rejected, _ := CheckGuards(r, guards...); rejected != nil {
+			rejected(w, r)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// GuardChain returns the guards of the route and its ancestors,
+// in the order they are checked: from the root down to the route.
+// An accepting guard skips the rest of the chain, including the
+// guards of the subroutes.
+func (r *RouteDef) GuardChain() []Guard {
+	var guards []Guard
+	for r != nil {
+		guards = append(append([]Guard{}, r.guards...), guards...)
+		r = r.parent
+	}
+	return guards
 }
 
 func (r *RouteDef) FullPath() string {
 	var paths []string
+	slash := r.endsWithSlash()
 	// A bit inefficient, but it'll do
 	for r != nil {
 		paths = append([]string{r.Path}, paths...)
 		r = r.parent
 	}
-	return filepath.Join(paths...)
+	path := filepath.Join(paths...)
+	if slash && path != "/" {
+		path += "/"
+	}
+	return path
 }
 
 func (r *RouteDef) String() string {
+	return r.Format()
+}
+
+// Format is like String, but with splitMethodsOpt set to true,
+// routes with several methods are listed once per method.
+// Routes of versions are listed under the heading of their version.
+func (r *RouteDef) Format(splitMethodsOpt ...bool) string {
 	var lines []string
 	col1Len := 0
 	col2Len := 0
-	r.Iter(func(sub *RouteDef) {
-		ms := stringMethods(sub.methods)
-		col1Len = int(math.Max(float64(col1Len), float64(len(ms))))
-		col2Len = int(math.Max(float64(col2Len), float64(len(sub.FullPath()))))
-	})
-	r.Iter(func(sub *RouteDef) {
-		ms := stringMethods(sub.methods)
-		fmts := fmt.Sprintf("%%-%vv  %%-%vv %%v", col1Len, col2Len)
-		line := fmt.Sprintf(fmts, ms, sub.FullPath(), sub.Name)
-		lines = append(lines, line)
-	})
+	tables := r.VersionTables(splitMethodsOpt...)
+	for _, table := range tables {
+		for _, entry := range table.Entries {
+			col1Len = int(math.Max(float64(col1Len), float64(len(entry.Methods))))
+			col2Len = int(math.Max(float64(col2Len), float64(len(entry.Path))))
+		}
+	}
+	for _, table := range tables {
+		if heading := table.heading(); heading != "" {
+			lines = append(lines, heading)
+		}
+		for _, entry := range table.Entries {
+			fmts := fmt.Sprintf("%%-%vv  %%-%vv %%v", col1Len, col2Len)
+			line := fmt.Sprintf(fmts, entry.Methods, entry.Path, entry.Name)
+			lines = append(lines, line)
+		}
+	}
 	return strings.Join(lines, "\n")
 }
 
-func (r *RouteDef) Table() []Entry {
+func (r *RouteDef) Table(splitMethodsOpt ...bool) []Entry {
+	splitMethods := len(splitMethodsOpt) > 0 && splitMethodsOpt[0]
+
 	var table []Entry
 	r.Iter(func(sub *RouteDef) {
-		entry := Entry{sub.Name, sub.FullPath(), stringMethods(sub.methods)}
-		table = append(table, entry)
+		table = append(table, tableEntries(sub, splitMethods)...)
 	})
 	return table
 }
 
+func tableEntries(r *RouteDef, splitMethods bool) []Entry {
+	if splitMethods && r.methods != nil {
+		var entries []Entry
+		for _, method := range r.methods {
+			entries = append(entries, Entry{r.Name, r.urlTemplate(), method})
+		}
+		return entries
+	}
+	return []Entry{{r.Name, r.urlTemplate(), stringMethods(r.methods)}}
+}
+
 func (r *RouteDef) CreateUrlFn(returnErrOpt ...bool) UrlFn {
 	routes := r.BuildNewRouter()
 	return CreateUrlFn(routes, returnErrOpt...)
@@ -327,31 +599,30 @@ func (r *RouteDef) CreateUrlFn(returnErrOpt ...bool) UrlFn {
 
 type UrlFn func(name string, params ...string) (string, error)
 
+// CreateUrlFn returns a function that creates the URL of a named route.
+// With returnErrOpt set to false, the function is Lenient with the
+// default options: failures yield "#" instead of an error.
 func CreateUrlFn(routes *mux.Router, returnErrOpt ...bool) UrlFn {
 	returnErr := true
 	if len(returnErrOpt) > 0 {
 		returnErr = returnErrOpt[0]
 	}
 
-	var __ = func(urlpath *url.URL, err error) (string, error) {
+	var urlfn UrlFn = func(name string, params ...string) (string, error) {
+		r := routes.Get(name)
+		if r == nil {
+			return "", errors.New("invalid route name: " + name)
+		}
+		urlpath, err := r.URL(params...)
 		if err != nil {
-			if returnErr {
-				return "", err
-			}
-			// embed error in the url
-			return url.QueryEscape(fmt.Sprint("(%s)", err.Error())), nil
+			return "", err
 		}
 		return urlpath.String(), nil
 	}
-
-	return func(name string, params ...string) (string, error) {
-		r := routes.Get(name)
-		if r != nil {
-			urlpath, err := r.URL(params...)
-			return __(urlpath, err)
-		}
-		return __(nil, errors.New("invalid route name"))
+	if !returnErr {
+		return urlfn.Lenient(LenientOptions{})
 	}
+	return urlfn
 }
 
 func PrintRouteDef(routeDef *RouteDef) {
@@ -367,57 +638,172 @@ func rootRoute(routeDef *RouteDef) *RouteDef {
 	return root
 }
 
+// expandReRoutes leaves the re-routes pending, they are resolved
+// once the subroutes are in place, see resolveReRoutes
 func expandReRoutes(base *RouteDef, routes []SubRouteDef) []*RouteDef {
 	var routes_ []*RouteDef
 	for _, r := range routes {
-		var reroute *ReRouteDef
-
 		switch t := r.(type) {
 		case *RouteDef:
 			routes_ = append(routes_, t)
-			continue
 		case *ReRouteDef:
-			reroute = t
+			base.unresolved = append(base.unresolved,
+				pendingReRoute{t, nil, len(routes_)})
+		case *VersionDef:
+			base.unresolved = append(base.unresolved,
+				pendingReRoute{t.reroute, t, len(routes_)})
 		}
+	}
+	return routes_
+}
 
-		rebase := searchRoute(reroute.destName, routes)
-
-		if rebase == nil {
-			println("Route not found:", reroute.destName,
-				"Re-route Must be the same level as the destination.")
-			continue
+// resolveReRoutes copies the destinations of the pending re-routes of
+// the waiting routes, searching the levels of the tree up to root that
+// weren't searched yet, so each level is searched once. It returns the
+// routes that are still waiting, for when root gets a parent.
+// The copies can have re-routes of their own, which wait as well.
+func resolveReRoutes(root *RouteDef, waiting []waitingRoute) []waitingRoute {
+	var still []waitingRoute
+	for i := 0; i < len(waiting); i++ {
+		base := waiting[i].route
+		start := base
+		if searched := waiting[i].searched; searched != nil {
+			start = searched.parent
 		}
-		var temp RouteDef
-		temp = *rebase
-		temp.Path = filepath.Join(reroute.pathPrefix, temp.Path)
-
-		rebase = temp.Map(func(route RouteDef) RouteDef {
-			route.Name = reroute.namePrefix + REROUTE_SEP + route.Name
-			return route
-		})
+		var pending []pendingReRoute
+		subroutes := base.subroutes
+		shift := 0
+		wait := false
+		for _, p := range base.unresolved {
+			p.pos += shift
+			dest := findDest(start, root, p.reroute)
+			switch {
+			case dest == nil:
+				pending = append(pending, p)
+				// the tree of From won't change
+				wait = wait || p.reroute.tree == nil
+			case isReRouteCycle(base, dest):
+				if p.reroute.cycle {
+					break
+				}
+				p.reroute.cycle = true
+				base.problems = append(base.problems, &ValidationError{
+					Kind:  ReRouteCycle,
+					Route: base.Name,
+					Path:  base.Path,
+					Msg: fmt.Sprintf("destination %q contains the re-route",
+						p.reroute.destName),
+				})
+			default:
+				clone := p.reroute.expand(dest)
+				clone.parent = base
+				if p.version != nil {
+					p.version.apply(clone)
+				}
+				subroutes = append(append(append([]*RouteDef{},
+					subroutes[:p.pos]...), clone), subroutes[p.pos:]...)
+				shift++
+				waiting = append(waiting, collectWaiting(clone)...)
+			}
+		}
+		base.subroutes = subroutes
+		base.unresolved = pending
+		if wait {
+			still = append(still, waitingRoute{base, root})
+		}
+	}
+	return still
+}
 
-		rebase.hooks = append(rebase.hooks, reroute.hooks...)
-		rebase.guards = append(rebase.guards, reroute.guards...)
-		routes_ = append(routes_, rebase)
+// findDest looks for the destination in the tree of the re-route, or
+// level by level: among the subroutes of start, then of its parent, up
+// to those of root, and root itself.
+func findDest(start *RouteDef, root *RouteDef, reroute *ReRouteDef) *RouteDef {
+	name := reroute.destName
+	if reroute.tree != nil {
+		return searchLevels(reroute.tree, name)
 	}
-	return routes_
+	for a := start; a != nil; a = a.parent {
+		for _, sub := range a.subroutes {
+			if sub.Name == name {
+				return sub
+			}
+		}
+		if a == root {
+			if a.Name == name {
+				return a
+			}
+			break
+		}
+	}
+	return nil
 }
 
-func searchRoute(name string, routes []SubRouteDef) *RouteDef {
-	for _, r := range routes {
-		var routeDef *RouteDef
+// searchLevels is a breadth-first Search
+func searchLevels(r *RouteDef, name string) *RouteDef {
+	level := []*RouteDef{r}
+	for len(level) > 0 {
+		var next []*RouteDef
+		for _, route := range level {
+			if route.Name == name {
+				return route
+			}
+			next = append(next, route.subroutes...)
+		}
+		level = next
+	}
+	return nil
+}
 
-		switch t := r.(type) {
-		case *RouteDef:
-			routeDef = t
-		default:
-			continue
+// collectWaiting returns the routes of the tree with pending re-routes,
+// which are searched from their own level.
+func collectWaiting(r *RouteDef) []waitingRoute {
+	var waiting []waitingRoute
+	r.Iter(func(route *RouteDef) {
+		route.waiting = nil
+		if len(route.unresolved) > 0 {
+			waiting = append(waiting, waitingRoute{route, nil})
 		}
-		if routeDef.Name == name {
-			return routeDef
+	})
+	return waiting
+}
+
+// a re-route to a route that contains it, or to a route that
+// one of its ancestors was copied from, would never end
+func isReRouteCycle(base *RouteDef, dest *RouteDef) bool {
+	for a := base; a != nil; a = a.parent {
+		if a == dest || a.origin == dest {
+			return true
 		}
 	}
-	return nil
+	return false
+}
+
+// expand copies the destination, with the prefixes and
+// the additions of the re-route
+func (reroute *ReRouteDef) expand(dest *RouteDef) *RouteDef {
+	temp := *dest
+	temp.Path = filepath.Join(reroute.pathPrefix, temp.Path)
+
+	// the problems of the destination are reported there
+	clone := mapRoute(&temp, func(route RouteDef) RouteDef {
+		route.Name = reroute.namePrefix + REROUTE_SEP + route.Name
+		route.problems = nil
+		return route
+	})
+
+	clone.reroute = reroute
+	clone.origin = dest
+	clone.hooks = append(append([]Hook{}, clone.hooks...), reroute.hooks...)
+	clone.reqHooks = append(append([]RequestHook{}, clone.reqHooks...),
+		reroute.reqHooks...)
+	clone.middleware = append(append([]Middleware{}, clone.middleware...),
+		reroute.middleware...)
+	clone.guards = append(append([]Guard{}, clone.guards...), reroute.guards...)
+	if reroute.host != "" {
+		clone.host = reroute.host
+	}
+	return clone
 }
 
 type Transformer interface {
@@ -429,10 +815,56 @@ type TransformerFunc func(*mux.Route)
 type Ts []Transformer
 
 func (ts Ts) Transform(r *mux.Route) {
+	ts.transform(r, SlashDefault, true, nil)
+}
+
+// Without a slash policy, the sub-routes redirect to the path
+// with a trailing slash, as they always did.
+func (ts Ts) transform(r *mux.Route, policy SlashPolicy, slash bool,
+	wrap func(ht.HandlerFunc) ht.HandlerFunc) {
 	sub := r.Subrouter()
-	sub.StrictSlash(true)
+	paths := []string{"/"}
+	switch policy {
+	case SlashDefault, SlashRedirect:
+		sub.StrictSlash(true)
+	case NoSlashRedirect:
+		sub.StrictSlash(true)
+		paths = []string{""}
+	case SlashBoth:
+		paths = []string{"", "/"}
+	case SlashStrict:
+		if !slash {
+			paths = []string{""}
+		}
+	}
 	for _, t := range ts {
-		t.Transform(sub.Path("/"))
+		for _, path := range paths {
+			transform(t, sub.Path(path), policy, slash, wrap)
+		}
+	}
+}
+
+// transform runs t on the route, looking into groups so that the
+// Ts get the slash policy, and passes the handler t sets, if any,
+// to wrap.
+func transform(t Transformer, route *mux.Route, policy SlashPolicy, slash bool,
+	wrap func(ht.HandlerFunc) ht.HandlerFunc) {
+	var run func(t Transformer)
+	run = func(t Transformer) {
+		switch t := t.(type) {
+		case group:
+			for _, t := range t {
+				run(t)
+			}
+		case Ts:
+			t.transform(route, policy, slash, wrap)
+		default:
+			t.Transform(route)
+		}
+	}
+	run(t)
+	if h := route.GetHandler(); h != nil && wrap != nil {
+		route.HandlerFunc(wrap(h.ServeHTTP))
 	}
 }
 
@@ -462,22 +894,25 @@ func With(handler ht.HandlerFunc, ts ...Transformer) HandlerT {
 	return HandlerT{handler, Group(ts...)}
 }
 
+// a group is kept as a list, so that the transformers
+// can be looked into, see queryPairs
+type group []Transformer
+
+func (g group) Transform(r *mux.Route) {
+	for _, t := range g {
+		t.Transform(r)
+	}
+}
+
 func Group(transformers ...Transformer) Transformer {
-	var ts []Transformer
+	var ts group
 	for _, t := range transformers {
 		if t == nil {
 			continue
 		}
 		ts = append(ts, t)
 	}
-
-	var f TransformerFunc
-	f = func(r *mux.Route) {
-		for _, t := range ts {
-			t.Transform(r)
-		}
-	}
-	return f
+	return ts
 }
 
 func Methods(methods ...string) func(string) pathod {
@@ -492,8 +927,12 @@ func Methods(methods ...string) func(string) pathod {
 var GET = Methods("GET")
 var POST = Methods("POST")
 var HEAD = Methods("HEAD")
-
-//...I'll add the others later
+var PUT = Methods("PUT")
+var PATCH = Methods("PATCH")
+var DELETE = Methods("DELETE")
+var OPTIONS = Methods("OPTIONS")
+var CONNECT = Methods("CONNECT")
+var TRACE = Methods("TRACE")
 
 func stringMethods(methods []string) string {
 	if methods == nil {
@@ -0,0 +1,424 @@
+package roudetef
+
+import (
+	"encoding/json"
+	"fmt"
+	ht "net/http"
+	"reflect"
+	"strings"
+)
+
+// Route definitions can be loaded from (and dumped to) a plain
+// data description. Handlers, guards, hooks and transformers
+// are referred to by name and resolved against a Registry.
+//
+// The spec types carry both json and yaml tags, so a YAML
+// file can be loaded by passing e.g. yaml.Unmarshal to Unmarshal.
+
+type RouteSpec struct {
+	Path          string       `json:"path" yaml:"path"`
+	Host          string       `json:"host,omitempty" yaml:"host,omitempty"`
+	Methods       []string     `json:"methods,omitempty" yaml:"methods,omitempty"`
+	Name          string       `json:"name,omitempty" yaml:"name,omitempty"`
+	Handler       string       `json:"handler,omitempty" yaml:"handler,omitempty"`
+	Transformers  []string     `json:"transformers,omitempty" yaml:"transformers,omitempty"`
+	Hooks         []string     `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+	Guards        []string     `json:"guards,omitempty" yaml:"guards,omitempty"`
+	Exact         *bool        `json:"exact,omitempty" yaml:"exact,omitempty"`
+	TrailingSlash string       `json:"trailingSlash,omitempty" yaml:"trailingSlash,omitempty"`
+	Subroutes     []RouteSpec  `json:"subroutes,omitempty" yaml:"subroutes,omitempty"`
+	ReRoute       *ReRouteSpec `json:"reroute,omitempty" yaml:"reroute,omitempty"`
+}
+
+// A subroute spec with ReRoute set describes a re-route,
+// the other fields are then ignored.
+type ReRouteSpec struct {
+	PathPrefix string   `json:"pathPrefix" yaml:"pathPrefix"`
+	NamePrefix string   `json:"namePrefix" yaml:"namePrefix"`
+	Dest       string   `json:"dest" yaml:"dest"`
+	Host       string   `json:"host,omitempty" yaml:"host,omitempty"`
+	Hooks      []string `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+	Guards     []string `json:"guards,omitempty" yaml:"guards,omitempty"`
+}
+
+type Registry struct {
+	Handlers     map[string]ht.HandlerFunc
+	Guards       map[string]Guard
+	Hooks        map[string]Hook
+	Transformers map[string]Transformer
+}
+
+// registry names of a loaded route
+type refs struct {
+	handler      string
+	transformers []string
+	hooks        []string
+	guards       []string
+}
+
+type RefError struct {
+	Route string
+	Kind  string
+	Ref   string
+	Msg   string
+}
+
+func (e *RefError) Error() string {
+	return fmt.Sprintf("route %q: %s %s %q", e.Route, e.Msg, e.Kind, e.Ref)
+}
+
+type Errors []error
+
+func (es Errors) Error() string {
+	var msgs []string
+	for _, e := range es {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		Handlers:     make(map[string]ht.HandlerFunc),
+		Guards:       make(map[string]Guard),
+		Hooks:        make(map[string]Hook),
+		Transformers: make(map[string]Transformer),
+	}
+}
+
+func (reg *Registry) Handler(name string, handler ht.HandlerFunc) *Registry {
+	reg.Handlers[name] = handler
+	return reg
+}
+
+func (reg *Registry) Guard(name string, guard Guard) *Registry {
+	reg.Guards[name] = guard
+	return reg
+}
+
+func (reg *Registry) Hook(name string, hook Hook) *Registry {
+	reg.Hooks[name] = hook
+	return reg
+}
+
+func (reg *Registry) Transformer(name string, t Transformer) *Registry {
+	reg.Transformers[name] = t
+	return reg
+}
+
+func Load(spec *RouteSpec, reg *Registry) (*RouteDef, error) {
+	var errs Errors
+	r := loadRoute(spec, reg, &errs)
+	r.Iter(func(r *RouteDef) {
+		for _, p := range r.unresolved {
+			errs = append(errs, &RefError{r.Name, "re-route destination",
+				p.reroute.destName, "unresolved"})
+		}
+		for _, problem := range r.problems {
+			errs = append(errs, problem)
+		}
+	})
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return r, nil
+}
+
+func LoadJSON(data []byte, reg *Registry) (*RouteDef, error) {
+	return Unmarshal(data, json.Unmarshal, reg)
+}
+
+func Unmarshal(data []byte, unmarshal func([]byte, interface{}) error,
+	reg *Registry) (*RouteDef, error) {
+	var spec RouteSpec
+	if err := unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+	return Load(&spec, reg)
+}
+
+func Dump(r *RouteDef, reg *Registry) (*RouteSpec, error) {
+	var errs Errors
+	spec := dumpRoute(r, reg, &errs)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return spec, nil
+}
+
+func DumpJSON(r *RouteDef, reg *Registry) ([]byte, error) {
+	return Marshal(r, func(v interface{}) ([]byte, error) {
+		return json.MarshalIndent(v, "", "  ")
+	}, reg)
+}
+
+func Marshal(r *RouteDef, marshal func(interface{}) ([]byte, error),
+	reg *Registry) ([]byte, error) {
+	spec, err := Dump(r, reg)
+	if err != nil {
+		return nil, err
+	}
+	return marshal(spec)
+}
+
+func (r *RouteDef) Dump(reg *Registry) (*RouteSpec, error) {
+	return Dump(r, reg)
+}
+
+func (r *RouteDef) DumpJSON(reg *Registry) ([]byte, error) {
+	return DumpJSON(r, reg)
+}
+
+func loadRoute(spec *RouteSpec, reg *Registry, errs *Errors) *RouteDef {
+	refErr := func(kind, ref string) {
+		*errs = append(*errs, &RefError{spec.Name, kind, ref, "unresolved"})
+	}
+
+	var handler ht.HandlerFunc
+	if spec.Handler != "" {
+		h, ok := reg.Handlers[spec.Handler]
+		if !ok {
+			refErr("handler", spec.Handler)
+		}
+		handler = h
+	}
+
+	var ts []Transformer
+	for _, name := range spec.Transformers {
+		t, ok := reg.Transformers[name]
+		if !ok {
+			refErr("transformer", name)
+		}
+		ts = append(ts, t)
+	}
+	var transformer Transformer
+	if len(ts) > 0 {
+		transformer = Group(ts...)
+	}
+
+	var slash SlashPolicy
+	if spec.TrailingSlash != "" {
+		slash = -1
+		for p, name := range slashPolicyNames {
+			if name == spec.TrailingSlash {
+				slash = p
+			}
+		}
+		if slash < 0 {
+			*errs = append(*errs, &RefError{spec.Name, "trailing slash policy",
+				spec.TrailingSlash, "unknown"})
+			slash = SlashDefault
+		}
+	}
+
+	var methods []string
+	if len(spec.Methods) > 0 {
+		methods = spec.Methods
+	}
+
+	r := &RouteDef{
+		Name:        spec.Name,
+		Path:        spec.Path,
+		methods:     methods,
+		Handler:     handler,
+		transformer: transformer,
+		hooks:       loadHooks(spec.Name, spec.Hooks, reg, errs),
+		guards:      loadGuards(spec.Name, spec.Guards, reg, errs),
+		exact:       spec.Exact,
+		slash:       slash,
+		host:        spec.Host,
+		refs: &refs{
+			handler:      spec.Handler,
+			transformers: spec.Transformers,
+			hooks:        spec.Hooks,
+			guards:       spec.Guards,
+		},
+	}
+	checkMethods(r)
+
+	var subroutes []SubRouteDef
+	for i := range spec.Subroutes {
+		sub := &spec.Subroutes[i]
+		if sub.ReRoute != nil {
+			subroutes = append(subroutes, loadReRoute(spec, sub.ReRoute, reg, errs))
+			continue
+		}
+		subroutes = append(subroutes, loadRoute(sub, reg, errs))
+	}
+	return withSubroutes(r, subroutes)
+}
+
+func loadReRoute(parent *RouteSpec, spec *ReRouteSpec, reg *Registry,
+	errs *Errors) *ReRouteDef {
+	reroute := ReRoute(spec.PathPrefix, spec.NamePrefix, spec.Dest,
+		loadHooks(parent.Name, spec.Hooks, reg, errs),
+		loadGuards(parent.Name, spec.Guards, reg, errs))
+	reroute.refs = &refs{hooks: spec.Hooks, guards: spec.Guards}
+	reroute.host = spec.Host
+	return reroute
+}
+
+func loadHooks(route string, names []string, reg *Registry, errs *Errors) []Hook {
+	var hooks []Hook
+	for _, name := range names {
+		hook, ok := reg.Hooks[name]
+		if !ok {
+			*errs = append(*errs, &RefError{route, "hook", name, "unresolved"})
+			continue
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks
+}
+
+func loadGuards(route string, names []string, reg *Registry, errs *Errors) []Guard {
+	var guards []Guard
+	for _, name := range names {
+		guard, ok := reg.Guards[name]
+		if !ok {
+			*errs = append(*errs, &RefError{route, "guard", name, "unresolved"})
+			continue
+		}
+		guards = append(guards, guard)
+	}
+	return guards
+}
+
+func dumpRoute(r *RouteDef, reg *Registry, errs *Errors) *RouteSpec {
+	spec := &RouteSpec{
+		Name:    r.Name,
+		Path:    r.Path,
+		Host:    r.host,
+		Methods: r.methods,
+		Exact:   r.exact,
+	}
+	if r.slash != SlashDefault {
+		spec.TrailingSlash = r.slash.String()
+	}
+	if r.refs != nil {
+		spec.Handler = r.refs.handler
+		spec.Transformers = r.refs.transformers
+		spec.Hooks = r.refs.hooks
+		spec.Guards = r.refs.guards
+	} else {
+		if r.Handler != nil {
+			names := reg.lookup(r.Name, "handler", reg.Handlers, r.Handler, errs)
+			if len(names) == 1 {
+				spec.Handler = names[0]
+			}
+		}
+		if r.transformer != nil {
+			spec.Transformers = reg.lookup(r.Name, "transformer",
+				reg.Transformers, r.transformer, errs)
+		}
+		spec.Hooks = reg.lookupHooks(r.Name, r.hooks, errs)
+		spec.Guards = reg.lookupGuards(r.Name, r.guards, errs)
+	}
+
+	for _, sub := range r.subroutes {
+		if sub.version != nil {
+			*errs = append(*errs, &RefError{r.Name, "version", sub.version.name,
+				"can't dump"})
+			continue
+		}
+		if sub.reroute != nil {
+			spec.Subroutes = append(spec.Subroutes, RouteSpec{
+				ReRoute: dumpReRoute(r, sub.reroute, reg, errs),
+			})
+			continue
+		}
+		spec.Subroutes = append(spec.Subroutes, *dumpRoute(sub, reg, errs))
+	}
+	return spec
+}
+
+func dumpReRoute(parent *RouteDef, reroute *ReRouteDef, reg *Registry,
+	errs *Errors) *ReRouteSpec {
+	spec := &ReRouteSpec{
+		PathPrefix: reroute.pathPrefix,
+		NamePrefix: reroute.namePrefix,
+		Dest:       reroute.destName,
+		Host:       reroute.host,
+	}
+	if reroute.tree != nil {
+		*errs = append(*errs, &RefError{parent.Name, "re-route tree",
+			reroute.tree.Name, "can't dump"})
+	}
+	if reroute.refs != nil {
+		spec.Hooks = reroute.refs.hooks
+		spec.Guards = reroute.refs.guards
+	} else {
+		spec.Hooks = reg.lookupHooks(parent.Name, reroute.hooks, errs)
+		spec.Guards = reg.lookupGuards(parent.Name, reroute.guards, errs)
+	}
+	return spec
+}
+
+func (reg *Registry) lookupHooks(route string, hooks []Hook, errs *Errors) []string {
+	var names []string
+	for _, hook := range hooks {
+		names = append(names, reg.lookup(route, "hook", reg.Hooks, hook, errs)...)
+	}
+	return names
+}
+
+func (reg *Registry) lookupGuards(route string, guards []Guard, errs *Errors) []string {
+	var names []string
+	for _, guard := range guards {
+		names = append(names, reg.lookup(route, "guard", reg.Guards, guard, errs)...)
+	}
+	return names
+}
+
+// lookup finds the name of v in the registry map m.
+// Functions are compared by code pointer, so closures created
+// by the same function are indistinguishable and are
+// reported as ambiguous.
+func (reg *Registry) lookup(route, kind string, m interface{}, v interface{},
+	errs *Errors) []string {
+
+	var names []string
+	iter := reflect.ValueOf(m).MapRange()
+	for iter.Next() {
+		if sameValue(iter.Value(), reflect.ValueOf(v)) {
+			names = append(names, iter.Key().String())
+		}
+	}
+	switch len(names) {
+	case 0:
+		*errs = append(*errs, &RefError{route, kind, fmt.Sprint(v), "unresolved"})
+	case 1:
+		return names
+	default:
+		*errs = append(*errs, &RefError{route, kind,
+			strings.Join(names, ","), "ambiguous"})
+	}
+	return nil
+}
+
+func sameValue(a, b reflect.Value) bool {
+	if a.Kind() == reflect.Interface {
+		a = a.Elem()
+	}
+	if b.Kind() == reflect.Interface {
+		b = b.Elem()
+	}
+	if !a.IsValid() || !b.IsValid() || a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Func:
+		return a.Pointer() == b.Pointer()
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !sameValue(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	if a.Type().Comparable() {
+		return a.Interface() == b.Interface()
+	}
+	return false
+}
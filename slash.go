@@ -0,0 +1,130 @@
+package roudetef
+
+import (
+	"github.com/gorilla/mux"
+	ht "net/http"
+	"strings"
+)
+
+// SlashPolicy tells what to do with a request path that differs
+// from the path of a route only by a trailing slash.
+type SlashPolicy int
+
+const (
+	// left to the router, see mux.Router.StrictSlash
+	SlashDefault SlashPolicy = iota
+	// /path is redirected to /path/
+	SlashRedirect
+	// /path/ is redirected to /path
+	NoSlashRedirect
+	// both /path and /path/ are matched
+	SlashBoth
+	// only the path as written is matched
+	SlashStrict
+)
+
+var slashPolicyNames = map[SlashPolicy]string{
+	SlashDefault:    "default",
+	SlashRedirect:   "redirect-slash",
+	NoSlashRedirect: "redirect-no-slash",
+	SlashBoth:       "both",
+	SlashStrict:     "strict",
+}
+
+func (p SlashPolicy) String() string {
+	return slashPolicyNames[p]
+}
+
+// TrailingSlash sets the policy of the route and its subroutes.
+// The policy takes over the StrictSlash setting of the router,
+// and FullPath and the URLs of the route end with a slash
+// when the policy is SlashRedirect, or SlashStrict with a
+// path written with a trailing slash.
+func (r *RouteDef) TrailingSlash(policy SlashPolicy) *RouteDef {
+	r.slash = policy
+	return r
+}
+
+func (b *RouteBuilder) TrailingSlash(policy SlashPolicy) *RouteBuilder {
+	b.route.TrailingSlash(policy)
+	return b
+}
+
+// SlashPolicy returns the policy of the route,
+// which is inherited from its parents.
+func (r *RouteDef) SlashPolicy() SlashPolicy {
+	for ; r != nil; r = r.parent {
+		if r.slash != SlashDefault {
+			return r.slash
+		}
+	}
+	return SlashDefault
+}
+
+// slashForms returns the path of the route as it is registered,
+// and the other form of the path, which is redirected to it,
+// also matched, or not matched, depending on the policy.
+// The other form is empty when the router handles the slashes.
+func (r *RouteDef) slashForms() (string, string) {
+	policy := r.SlashPolicy()
+	trimmed := strings.TrimRight(r.Path, "/")
+	if policy == SlashDefault || trimmed == "" {
+		return r.Path, ""
+	}
+	if policy == SlashRedirect ||
+		policy == SlashStrict && strings.HasSuffix(r.Path, "/") {
+		return trimmed + "/", trimmed
+	}
+	return trimmed, trimmed + "/"
+}
+
+func (r *RouteDef) endsWithSlash() bool {
+	path, other := r.slashForms()
+	return other != "" && strings.HasSuffix(path, "/")
+}
+
+// addSlashForm registers the other form of the path of a route,
+// before the route itself. Wrap is applied to the handlers
+// set by the transformer, as in buildRoute.
+func addSlashForm(router *mux.Router, r *RouteDef, tmpl string, handler ht.HandlerFunc,
+	wrap func(ht.HandlerFunc) ht.HandlerFunc) {
+	var h ht.Handler
+	policy := r.SlashPolicy()
+	switch policy {
+	case SlashRedirect:
+		h = redirectSlash(true)
+	case NoSlashRedirect:
+		h = redirectSlash(false)
+	case SlashBoth:
+		h = handler
+	default:
+		return
+	}
+	route := router.Path(tmpl)
+	if r.host != "" {
+		route.Host(r.host)
+	}
+	if r.methods != nil {
+		route.Methods(r.methods...)
+	}
+	if policy == SlashBoth && r.transformer != nil {
+		transform(r.transformer, route, policy, r.endsWithSlash(), wrap)
+	}
+	if route.GetHandler() == nil {
+		route.Handler(h)
+	}
+}
+
+// same status as the redirects of mux.Router.StrictSlash
+func redirectSlash(slash bool) ht.Handler {
+	return ht.HandlerFunc(func(w ht.ResponseWriter, r *ht.Request) {
+		u := *r.URL
+		u.RawPath = ""
+		if slash {
+			u.Path += "/"
+		} else {
+			u.Path = strings.TrimRight(u.Path, "/")
+		}
+		ht.Redirect(w, r, u.String(), ht.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,96 @@
+package roudetef
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A part of a mux path template: either a literal,
+// or a {name} or {name:pattern} variable.
+type tmplPart struct {
+	literal string
+	name    string
+	pattern string
+}
+
+func (p tmplPart) isVar() bool {
+	return p.name != ""
+}
+
+// parseTemplate splits a mux template into literals and variables.
+// Braces inside a variable pattern, such as {id:[0-9]{3}}, are
+// nested as in mux.
+func parseTemplate(tmpl string) ([]tmplPart, error) {
+	var parts []tmplPart
+	level := 0
+	start := 0
+	for i := 0; i < len(tmpl); i++ {
+		switch tmpl[i] {
+		case '{':
+			if level == 0 {
+				if i > start {
+					parts = append(parts, tmplPart{literal: tmpl[start:i]})
+				}
+				start = i
+			}
+			level++
+		case '}':
+			level--
+			if level < 0 {
+				return nil, fmt.Errorf("unbalanced braces in %q", tmpl)
+			}
+			if level == 0 {
+				v := tmpl[start+1 : i]
+				name, pattern := v, ""
+				if j := strings.Index(v, ":"); j >= 0 {
+					name, pattern = v[:j], v[j+1:]
+				}
+				if name == "" {
+					return nil, fmt.Errorf("missing variable name in %q", tmpl)
+				}
+				parts = append(parts, tmplPart{name: name, pattern: pattern})
+				start = i + 1
+			}
+		}
+	}
+	if level != 0 {
+		return nil, fmt.Errorf("unbalanced braces in %q", tmpl)
+	}
+	if start < len(tmpl) {
+		parts = append(parts, tmplPart{literal: tmpl[start:]})
+	}
+	return parts, nil
+}
+
+// templateVars returns the variable parts of a template
+func templateVars(tmpl string) []tmplPart {
+	parts, _ := parseTemplate(tmpl)
+	var vars []tmplPart
+	for _, p := range parts {
+		if p.isVar() {
+			vars = append(vars, p)
+		}
+	}
+	return vars
+}
+
+// explicitPatterns sets the pattern of the variables
+// of a template that have none.
+func explicitPatterns(tmpl, pattern string) string {
+	parts, err := parseTemplate(tmpl)
+	if err != nil {
+		return tmpl
+	}
+	var s []string
+	for _, p := range parts {
+		switch {
+		case !p.isVar():
+			s = append(s, p.literal)
+		case p.pattern == "":
+			s = append(s, "{"+p.name+":"+pattern+"}")
+		default:
+			s = append(s, "{"+p.name+":"+p.pattern+"}")
+		}
+	}
+	return strings.Join(s, "")
+}
@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
 	def "github.com/nvlled/roudetef"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"html/template"
+	"io/ioutil"
 	"net/http"
-	//"fmt"
 	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
 	"testing"
-	//"github.com/gorilla/mux"
-	"io/ioutil"
-	//"fmt"
-	//"strings"
+	"time"
 	//"path/filepath"
 )
 
@@ -299,3 +310,1820 @@ func sameTable(t1 []def.Entry, t2 []def.Entry) bool {
 	}
 	return true
 }
+
+func TestLoadJSON(t *testing.T) {
+	reg := def.NewRegistry().
+		Handler("a", a).Handler("b", b).Handler("c", c).Handler("d", d).
+		Handler("login", login).
+		Guard("require-login", requireLogin).
+		Transformer("x-123", def.Headers("X", "123"))
+
+	data := []byte(`{
+		"path": "/", "name": "home-path", "handler": "a",
+		"subroutes": [
+			{"path": "/login", "name": "login-path", "handler": "login"},
+			{"path": "/submit", "name": "submit-post", "handler": "b",
+			 "methods": ["POST"], "transformers": ["x-123"]},
+			{"path": "/a", "name": "a-path", "handler": "a",
+			 "guards": ["require-login"],
+			 "subroutes": [
+				{"path": "/b", "name": "b-path", "handler": "b",
+				 "subroutes": [{"path": "/c", "name": "c-path", "handler": "c"}]},
+				{"path": "/d", "name": "d-path", "handler": "d"}
+			]},
+			{"reroute": {"pathPrefix": "/api", "namePrefix": "json", "dest": "a-path"}}
+		]
+	}`)
+	routeDef, err := def.LoadJSON(data, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []def.Entry{
+		def.Entry{"home-path", "/", "ANY"},
+		def.Entry{"login-path", "/login", "ANY"},
+		def.Entry{"submit-post", "/submit", "POST"},
+		def.Entry{"a-path", "/a", "ANY"},
+		def.Entry{"b-path", "/a/b", "ANY"},
+		def.Entry{"c-path", "/a/b/c", "ANY"},
+		def.Entry{"d-path", "/a/d", "ANY"},
+		def.Entry{"json/a-path", "/api/a", "ANY"},
+		def.Entry{"json/b-path", "/api/a/b", "ANY"},
+		def.Entry{"json/c-path", "/api/a/b/c", "ANY"},
+		def.Entry{"json/d-path", "/api/a/d", "ANY"},
+	}
+	if !sameTable(routeDef.Table(), expected) {
+		t.Error("loaded routes differ")
+	}
+
+	server := httptest.NewServer(routeDef.BuildNewRouter())
+	c := createClient()
+	if resp, _ := c.Get(server.URL + "/a/b"); resp.StatusCode == http.StatusOK {
+		t.Error("guard was not loaded")
+	}
+	c.Get(server.URL + "/login")
+	if get(c, server.URL+"/api/a/b/c") != message["c-path"] {
+		t.Error("wrong handler for re-routed path")
+	}
+	resp, _ := request(c, "POST", server.URL+"/submit/", "X", "123")
+	if resp.StatusCode != http.StatusOK {
+		t.Error("transformer was not loaded")
+	}
+
+	data2, err := routeDef.DumpJSON(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routeDef2, err := def.LoadJSON(data2, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data3, _ := routeDef2.DumpJSON(reg)
+	if string(data2) != string(data3) || !sameTable(routeDef2.Table(), expected) {
+		t.Error("round trip failed")
+	}
+
+	_, err = def.LoadJSON([]byte(`{
+		"path": "/", "name": "home-path", "handler": "nope",
+		"subroutes": [{"reroute": {"pathPrefix": "/x", "dest": "y-path"}}]
+	}`), reg)
+	errs, ok := err.(def.Errors)
+	if !ok || len(errs) != 2 {
+		t.Error("unresolved names should be reported", err)
+	}
+}
+
+func TestDumpRouteDef(t *testing.T) {
+	reg := def.NewRegistry().
+		Handler("a", a).Handler("b", b).Handler("c", c).Handler("d", d).
+		Guard("require-login", requireLogin)
+
+	routeDef := def.SRoute(
+		"/", a, "home-path",
+		def.Route(
+			"/a", a, "a-path",
+			def.Hooks(), def.Guards(requireLogin),
+			def.SRoute(def.GET("/b"), b, "b-path"),
+		),
+		def.ReSRoute("/api", "json", "a-path"),
+	)
+	spec, err := routeDef.Dump(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Subroutes) != 2 || spec.Subroutes[1].ReRoute == nil ||
+		spec.Subroutes[0].Guards[0] != "require-login" ||
+		spec.Subroutes[0].Subroutes[0].Methods[0] != "GET" {
+		t.Error("wrong spec", spec)
+	}
+	routeDef2, err := def.Load(spec, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameTable(routeDef.Table(), routeDef2.Table()) {
+		t.Error("round trip failed")
+	}
+
+	routeDef = def.SRoute("/", func(w http.ResponseWriter, r *http.Request) {
+		broke(w, r)
+	}, "broke-path")
+	if _, err := routeDef.Dump(reg); err == nil {
+		t.Error("unregistered handler should be an error")
+	}
+}
+
+func TestAcceptGuard(t *testing.T) {
+	root, _ := createHandler()
+	server := httptest.NewServer(root)
+	client := createClient()
+
+	// the internal key skips both the login guard of /a
+	// and the diarrhea guard of /a/d
+	for _, path := range []string{"/a", "/a/b/c", "/a/d"} {
+		resp, _ := request(client, "GET", server.URL+path, "X-Api-Key", "internal")
+		if resp.StatusCode != http.StatusOK {
+			t.Error("internal key should be accepted for", path)
+		}
+		resp, _ = request(client, "GET", server.URL+path, "X-Api-Key", "external")
+		if resp.StatusCode == http.StatusOK {
+			t.Error("login should be required for", path)
+		}
+	}
+
+	// logged in, but without diarrhea
+	client = createClient()
+	client.Get(server.URL + "/login")
+	resp, _ := client.Get(server.URL + "/a/d")
+	if resp.StatusCode == http.StatusOK {
+		t.Error("diarrhea guard should reject")
+	}
+}
+
+func TestGuardTrace(t *testing.T) {
+	routeDef := routeDefinition()
+	chain := routeDef.Search("d-path").GuardChain()
+
+	req, _ := http.NewRequest("GET", "/a/d", nil)
+	handler, steps := def.CheckGuards(req, chain...)
+	expected := []def.GuardStep{
+		def.GuardStep{"allow-internal", def.GuardPassed},
+		def.GuardStep{"require-login", def.GuardRejected},
+	}
+	if handler == nil || !sameSteps(steps, expected) {
+		t.Error("wrong guard trace", steps)
+	}
+
+	req.Header.Set("X-Api-Key", "internal")
+	handler, steps = def.CheckGuards(req, chain...)
+	expected = []def.GuardStep{
+		def.GuardStep{"allow-internal", def.GuardAccepted},
+	}
+	if handler != nil || !sameSteps(steps, expected) {
+		t.Error("wrong guard trace", steps)
+	}
+}
+
+func sameSteps(s1 []def.GuardStep, s2 []def.GuardStep) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+	for i, _ := range s1 {
+		if s1[i] != s2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestValidate(t *testing.T) {
+	if err := routeDefinition().Validate(); err != nil {
+		t.Error("test routes should be valid:", err)
+	}
+
+	routeDef := def.SRoute(
+		"/", a, "home-path",
+		def.SRoute("/a", a, "a-path"),
+		def.SRoute("/b", b, "a-path"),
+		def.SRoute(def.GET("/c"), c, "c-get"),
+		def.SRoute(def.Methods("GET", "POST")("/c"), c, "c-any"),
+		def.SRoute(def.Methods("G ET")("/d"), d, "d-path"),
+		def.SRoute("/e/{id:[0-9+}", d, "e-path"),
+		def.Route("/f", nil, "f-path", def.Hooks(), def.Guards()),
+		def.ReSRoute("/api", "json", "x-path"),
+	)
+	expected := []def.ValidationKind{
+		def.DuplicateName,
+		def.PathConflict,
+		def.BadMethod,
+		def.BadPathTemplate,
+		def.NilHandler,
+		def.UnresolvedReRoute,
+	}
+	errs, _ := routeDef.Validate().(def.Errors)
+	if len(errs) != len(expected) {
+		t.Fatal("wrong number of errors:", errs)
+	}
+	for _, kind := range expected {
+		found := false
+		for _, err := range errs {
+			if err.(*def.ValidationError).Kind == kind {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("missing error:", kind)
+		}
+	}
+
+	if _, err := routeDef.BuildRouterStrict(mux.NewRouter()); err == nil {
+		t.Error("strict build should fail")
+	}
+
+	// the handler can be set by a transformer
+	routeDef = def.SRoute(
+		"/", a, "home-path",
+		def.SRoute("/a", def.With(nil, def.H(a)), "a-path"),
+		def.SRoute("/b", def.With(nil, def.Ts{def.H(b)}), "b-path"),
+	)
+	if _, err := routeDef.BuildRouterStrict(mux.NewRouter()); err != nil {
+		t.Error("handlers of transformers should count:", err)
+	}
+	routeDef = def.SRoute("/", a, "home-path",
+		def.SRoute("/a", def.With(nil, def.Queries("x", "1")), "a-path"))
+	errs, _ = routeDef.Validate().(def.Errors)
+	if len(errs) != 1 || errs[0].(*def.ValidationError).Kind != def.NilHandler {
+		t.Error("expected a nil handler, got", errs)
+	}
+}
+
+// Unresolved re-routes are only reported by Validate. The runtime
+// println doesn't go through os.Stderr, hence the subprocess.
+func TestUnresolvedReRouteIsQuiet(t *testing.T) {
+	if os.Getenv("ROUDETEF_QUIET") == "1" {
+		def.SRoute("/", nil, "root", def.ReSRoute("/api", "json", "nope"))
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestUnresolvedReRouteIsQuiet$")
+	cmd.Env = append(os.Environ(), "ROUDETEF_QUIET=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil || strings.TrimSpace(string(out)) != "PASS" {
+		t.Errorf("unexpected output: %q %v", out, err)
+	}
+}
+
+func TestRouteBuilder(t *testing.T) {
+	routeDef, err := def.NewRoute("home-path").Path("/").HandlerFunc(home).Sub(
+		def.NewRoute("submit-get").At(def.GET("/submit")).HandlerFunc(b),
+		def.NewRoute("submit-post").At(def.POST("/submit")).
+			With(def.With(c, def.Headers("X", "123"))),
+		def.NewRoute("a-path").Path("/a").Handler(http.HandlerFunc(a)).
+			Guards(requireLogin).
+			Sub(
+				def.NewRoute("b-path").Path("/b").HandlerFunc(b),
+				def.SRoute("/d", d, "d-path"),
+			),
+		def.ReSRoute("/api", "json", "a-path"),
+	).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []def.Entry{
+		def.Entry{"home-path", "/", "ANY"},
+		def.Entry{"submit-get", "/submit", "GET"},
+		def.Entry{"submit-post", "/submit", "POST"},
+		def.Entry{"a-path", "/a", "ANY"},
+		def.Entry{"b-path", "/a/b", "ANY"},
+		def.Entry{"d-path", "/a/d", "ANY"},
+		def.Entry{"json/a-path", "/api/a", "ANY"},
+		def.Entry{"json/b-path", "/api/a/b", "ANY"},
+		def.Entry{"json/d-path", "/api/a/d", "ANY"},
+	}
+	if !sameTable(routeDef.Table(), expected) {
+		t.Error("built routes differ")
+	}
+
+	server := httptest.NewServer(routeDef.BuildNewRouter())
+	resp, _ := request(createClient(), "POST", server.URL+"/submit/", "X", "123")
+	if resp.StatusCode != http.StatusOK {
+		t.Error("transformer was not set")
+	}
+
+	_, err = def.NewRoute("home-path").Path("/").Sub(
+		def.NewRoute("x-path").Methods("G ET"),
+		def.ReSRoute("/api", "json", "y-path"),
+	).Build()
+	if errs, ok := err.(def.Errors); !ok || len(errs) != 2 {
+		t.Error("errors expected", err)
+	}
+
+	// builders mixed with SRoute, reported once by Validate
+	routeDef = def.SRoute("/", home, "home-path",
+		def.NewRoute("x-path").Methods("G ET").Path("/x").HandlerFunc(a))
+	errs, _ := routeDef.Validate().(def.Errors)
+	if len(errs) != 1 || errs[0].(*def.ValidationError).Kind != def.BadMethod {
+		t.Error("expected a bad method, got", errs)
+	}
+}
+
+func TestMethodSet(t *testing.T) {
+	read := def.MethodSet{"GET", "HEAD"}
+	write := def.MethodSet{"POST", "PUT", "GET"}
+	if read.Union(write).String() != "GET,HEAD,POST,PUT" {
+		t.Error("wrong union", read.Union(write))
+	}
+	if read.Union(nil) != nil || read.Intersect(write).String() != "GET" {
+		t.Error("nil method set should match any method")
+	}
+
+	routeDef := def.SRoute(
+		"/", a, "home-path",
+		def.SRoute(read.Union(def.MethodSet{"DELETE"}).At("/a"), a, "a-path"),
+		def.SRoute(def.PATCH("/b"), b, "b-path"),
+	)
+	expected := []def.Entry{
+		def.Entry{"home-path", "/", "ANY"},
+		def.Entry{"a-path", "/a", "GET"},
+		def.Entry{"a-path", "/a", "HEAD"},
+		def.Entry{"a-path", "/a", "DELETE"},
+		def.Entry{"b-path", "/b", "PATCH"},
+	}
+	if !sameTable(routeDef.Table(true), expected) {
+		t.Error("wrong per-method table")
+	}
+	if len(routeDef.Table()) != 3 {
+		t.Error("methods should be grouped by default")
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	root, _ := createHandler()
+	server := httptest.NewServer(root)
+	c := createClient()
+
+	resp, _ := request(c, "DELETE", server.URL+"/submit/")
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Error("405 expected, got", resp.StatusCode)
+	}
+	if resp.Header.Get("Allow") != "GET, POST, OPTIONS" {
+		t.Error("wrong Allow header:", resp.Header.Get("Allow"))
+	}
+
+	resp, _ = request(c, "OPTIONS", server.URL+"/submit/")
+	if resp.StatusCode != http.StatusOK ||
+		resp.Header.Get("Allow") != "GET, POST, OPTIONS" {
+		t.Error("wrong OPTIONS response", resp.StatusCode, resp.Header)
+	}
+
+	// any method is allowed on /login
+	resp, _ = request(c, "DELETE", server.URL+"/login/")
+	if resp.StatusCode != http.StatusOK {
+		t.Error("login should accept any method")
+	}
+
+	resp, _ = request(c, "DELETE", server.URL+"/submitted")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Error("404 expected for a path under /submit, got", resp.StatusCode)
+	}
+
+	routeDef := def.SRoute(
+		"/", a, "home-path",
+		def.Route(def.GET("/secret"), a, "secret-path", def.Hooks(),
+			def.Guards(requireLogin)),
+	)
+	server = httptest.NewServer(routeDef.BuildNewRouter())
+	defer server.Close()
+	resp, _ = request(createClient(), "DELETE", server.URL+"/secret")
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("Allow") != "" {
+		t.Error("the fallback should check the guards", resp.StatusCode)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	routeDef := def.SRoute(
+		"/", home, "home-path",
+		def.NewRoute("user-path").At(def.Methods("GET", "PUT")("/user/{id:[0-9]{1,8}}")).
+			HandlerFunc(a).
+			Describe(def.APIOperation{
+				Summary: "A user",
+				Tags:    []string{"users"},
+				Parameters: []def.APIParameter{
+					{Name: "id", In: "path", Required: true,
+						Description: "user id", Schema: def.APISchema{"type": "integer"}},
+					{Name: "verbose", In: "query"},
+				},
+			}),
+		def.SRoute("/group", nil, "group-path",
+			def.SRoute(def.POST("/{name}"), b, "group-post"),
+		),
+	)
+	doc := routeDef.OpenAPI(def.APIOptions{Title: "test", Version: "1"})
+
+	if len(doc.Paths) != 3 || doc.Paths["/group"] != nil {
+		t.Error("wrong paths:", doc.Paths)
+	}
+	if doc.Paths["/"]["get"].OperationID != "home-path" {
+		t.Error("routes with any method should be documented as GET")
+	}
+	op := doc.Paths["/user/{id}"]["put"]
+	if op == nil || op.OperationID != "user-path-put" || op.Summary != "A user" {
+		t.Fatal("wrong operation:", op)
+	}
+	if len(op.Parameters) != 2 || op.Parameters[0].Description != "user id" ||
+		op.Parameters[1].Name != "verbose" {
+		t.Error("wrong parameters:", op.Parameters)
+	}
+	op = doc.Paths["/group/{name}"]["post"]
+	if op == nil || op.OperationID != "group-post" || op.Parameters[0].Name != "name" {
+		t.Error("wrong operation:", op)
+	}
+	if _, err := json.Marshal(doc); err != nil {
+		t.Error(err)
+	}
+}
+
+var ownerKey = def.NewMetaKey[string]("owner")
+var scopeKey = def.NewMetaKey[[]string]("scope")
+
+func TestMeta(t *testing.T) {
+	var handled string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		handled, _ = ownerKey.Request(r)
+	}
+	routeDef := def.SRoute(
+		"/", handler, "home-path",
+		def.NewRoute("a-path").Path("/a").HandlerFunc(handler).
+			Meta(ownerKey.Value("team-a"), scopeKey.Value([]string{"read"})).
+			Sub(
+				def.SRoute("/b", handler, "b-path"),
+				def.NewRoute("c-path").Path("/c").HandlerFunc(handler).
+					Meta(ownerKey.Value("team-c")),
+			),
+		def.ReSRoute("/api", "json", "a-path"),
+	)
+
+	expected := map[string]string{
+		"home-path":   "",
+		"a-path":      "team-a",
+		"b-path":      "team-a",
+		"c-path":      "team-c",
+		"json/b-path": "team-a",
+		"json/c-path": "team-c",
+	}
+	for name, owner := range expected {
+		if v, _ := ownerKey.Get(routeDef.Search(name)); v != owner {
+			t.Error("wrong owner for", name, v)
+		}
+	}
+	if _, ok := ownerKey.Own(routeDef.Search("b-path")); ok {
+		t.Error("b-path has no owner of its own")
+	}
+	if scope, _ := scopeKey.Get(routeDef.Search("c-path")); scope[0] != "read" {
+		t.Error("wrong scope for c-path")
+	}
+
+	routeDef2 := routeDef.Map(func(r def.RouteDef) def.RouteDef {
+		if r.Name == "a-path" {
+			ownerKey.Set(&r, "team-x")
+		}
+		return r
+	})
+	if v, _ := ownerKey.Get(routeDef2.Search("b-path")); v != "team-x" {
+		t.Error("metadata should be mapped")
+	}
+	if v, _ := ownerKey.Get(routeDef.Search("b-path")); v != "team-a" {
+		t.Error("original route should not be modified")
+	}
+
+	server := httptest.NewServer(routeDef.BuildNewRouter())
+	for _, path := range []string{"/a/b", "/api/a/c"} {
+		get(createClient(), server.URL+path)
+		if path == "/a/b" && handled != "team-a" || path == "/api/a/c" && handled != "team-c" {
+			t.Error("wrong owner in handler for", path, handled)
+		}
+	}
+}
+
+func TestMatchedRoute(t *testing.T) {
+	var handled, hooked, rejected *def.RouteDef
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		handled = def.MatchedRoute(r)
+	}
+	routeDef := def.SRoute(
+		"/", handler, "home-path",
+		def.Route(
+			"/a", handler, "a-path",
+			def.Hooks(func(r *http.Request) { hooked = def.MatchedRoute(r) }),
+			def.Guards(def.RejectIf(
+				func(r *http.Request) bool { return r.URL.Query().Get("x") != "" },
+				func(w http.ResponseWriter, r *http.Request) {
+					rejected = def.MatchedRoute(r)
+				},
+			)),
+			def.SRoute("/b", handler, "b-path"),
+		),
+	)
+	server := httptest.NewServer(routeDef.BuildNewRouter())
+
+	get(createClient(), server.URL+"/a/b")
+	if handled == nil || handled.Name != "b-path" || handled.FullPath() != "/a/b" {
+		t.Fatal("wrong matched route:", handled)
+	}
+	if hooked == nil || hooked.Name != "b-path" {
+		t.Error("hook should see the matched route:", hooked)
+	}
+	chain := handled.Chain()
+	if len(chain) != 3 || chain[0].Name != "home-path" ||
+		chain[1] != handled.Parent() {
+		t.Error("wrong route chain")
+	}
+
+	get(createClient(), server.URL+"/a/b?x=1")
+	if rejected == nil || rejected.Name != "b-path" {
+		t.Error("guard handler should see the matched route:", rejected)
+	}
+}
+
+type userKey struct{}
+
+func TestRequestHook(t *testing.T) {
+	loadUser := func(r *http.Request) (*http.Request, error) {
+		name := r.URL.Query().Get("user")
+		if name == "" {
+			return nil, def.Fail(http.StatusForbidden, "no user")
+		}
+		if name == "error" {
+			return nil, errors.New("db error")
+		}
+		ctx := context.WithValue(r.Context(), userKey{}, name)
+		return r.WithContext(ctx), nil
+	}
+	var order []string
+	trace := func(name string) def.RequestHook {
+		return func(r *http.Request) (*http.Request, error) {
+			order = append(order, name)
+			return nil, nil
+		}
+	}
+	greet := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello ", r.Context().Value(userKey{}))
+	}
+	notBob := def.RejectIf(func(r *http.Request) bool {
+		return r.Context().Value(userKey{}) == "bob"
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	routeDef, _ := def.NewRoute("home-path").Path("/").HandlerFunc(home).Sub(
+		def.NewRoute("a-path").Path("/a").HandlerFunc(greet).
+			RequestHooks(trace("a"), loadUser).
+			Sub(def.NewRoute("b-path").Path("/b").HandlerFunc(greet).
+				RequestHooks(trace("b")).Guards(notBob)),
+		def.ReSRoute("/api", "json", "a-path").RequestHooks(trace("json")),
+	).Build()
+	server := httptest.NewServer(routeDef.BuildNewRouter())
+	c := createClient()
+
+	if s := get(c, server.URL+"/a/b?user=joe"); s != "hello joe" {
+		t.Error("user should be loaded from the parent's hook:", s)
+	}
+	if strings.Join(order, ",") != "a,b" {
+		t.Error("wrong hook order:", order)
+	}
+	order = nil
+	get(c, server.URL+"/api/a/b?user=joe")
+	if strings.Join(order, ",") != "a,json,b" {
+		t.Error("wrong hook order for re-route:", order)
+	}
+	if resp, _ := c.Get(server.URL + "/a/b"); resp.StatusCode != http.StatusForbidden {
+		t.Error("403 expected")
+	}
+	if resp, _ := c.Get(server.URL + "/a/b?user=bob"); resp.StatusCode != http.StatusForbidden {
+		t.Error("guards should see the user loaded by the hooks")
+	}
+	if resp, _ := c.Get(server.URL + "/a?user=error"); resp.StatusCode != http.StatusInternalServerError {
+		t.Error("500 expected")
+	}
+}
+
+func TestHookOnce(t *testing.T) {
+	var hooks []string
+	hook := func(name string) def.Hook {
+		return func(r *http.Request) {
+			hooks = append(hooks, name)
+		}
+	}
+	guard := func(name string) def.Guard {
+		return def.RejectIf(func(r *http.Request) bool {
+			hooks = append(hooks, "guard-"+name)
+			return false
+		}, nil)
+	}
+	routeDef := def.SRoute(
+		"/", a, "home-path",
+		def.Route(
+			"/a", a, "a-path",
+			def.Hooks(hook("a")), def.Guards(guard("a")),
+			def.Route(def.GET("/b"), b, "b-get",
+				def.Hooks(hook("b-get")), def.Guards(guard("b-get"))),
+			def.Route(def.POST("/b"), b, "b-post",
+				def.Hooks(hook("b-post")), def.Guards(guard("b-post"))),
+			def.Route("/c", c, "c-path",
+				def.Hooks(hook("c")), def.Guards(guard("c"))),
+		),
+	)
+	server := httptest.NewServer(routeDef.BuildNewRouter())
+	c := createClient()
+
+	expected := map[string]string{
+		"POST /a/b": "a,b-post,guard-a,guard-b-post",
+		"GET /a/b":  "a,b-get,guard-a,guard-b-get",
+		"GET /a/c":  "a,c,guard-a,guard-c",
+		"GET /a":    "a,guard-a",
+		// the fallback only runs the guards /a/b routes share
+		"PUT /a/b": "guard-a",
+	}
+	for req, trace := range expected {
+		hooks = nil
+		fields := strings.Fields(req)
+		request(c, fields[0], server.URL+fields[1])
+		if strings.Join(hooks, ",") != trace {
+			t.Error("wrong hooks for", req, hooks)
+		}
+	}
+}
+
+func TestTransformerHandlers(t *testing.T) {
+	secret := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "secret")
+	}
+	reject := def.RejectIf(func(r *http.Request) bool { return true },
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	var hooks []string
+	routeDef := def.SRoute(
+		"/", a, "home-path",
+		def.Route("/adm", def.With(a, def.Ts{def.H(secret)}), "adm-path",
+			def.Hooks(), def.Guards(reject)),
+		def.Route("/h", def.With(a, def.H(secret)), "h-path",
+			def.Hooks(func(r *http.Request) { hooks = append(hooks, "h") }),
+			def.Guards()),
+	)
+	server := httptest.NewServer(routeDef.BuildNewRouter())
+	defer server.Close()
+	c := createClient()
+
+	if resp, body := request(c, "GET", server.URL+"/adm"); resp.StatusCode != http.StatusUnauthorized {
+		t.Error("the guard should reject the Ts handler:", resp.StatusCode, body)
+	}
+	if s := get(c, server.URL+"/h"); s != "secret" || strings.Join(hooks, ",") != "h" {
+		t.Error("the hooks should run once for the H handler:", s, hooks)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var trace []string
+	mw := func(name string) def.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				trace = append(trace, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	hook := func(r *http.Request) { trace = append(trace, "hook") }
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		trace = append(trace, "handler")
+	}
+
+	routeDef := def.SRoute(
+		"/", handler, "home-path",
+		def.Route("/a", handler, "a-path", def.Hooks(hook), def.Guards(),
+			def.SRoute("/b", handler, "b-path"),
+		).Use(mw("a1"), mw("a2")),
+		def.ReSRoute("/api", "json", "a-path").Use(mw("json")),
+	).Use(mw("root"))
+	server := httptest.NewServer(routeDef.BuildNewRouter())
+
+	expected := map[string]string{
+		"/":         "root,handler",
+		"/a/b":      "root,a1,a2,hook,handler",
+		"/api/a/b/": "root,a1,a2,json,hook,handler",
+	}
+	for path, s := range expected {
+		trace = nil
+		get(createClient(), server.URL+path)
+		if strings.Join(trace, ",") != s {
+			t.Error("wrong middleware order for", path, trace)
+		}
+	}
+
+	// the method fallbacks too
+	routeDef = def.SRoute(
+		"/", handler, "home-path",
+		def.SRoute(def.GET("/a"), handler, "a-path"),
+	).Use(mw("root"))
+	server = httptest.NewServer(routeDef.BuildNewRouter())
+	for _, method := range []string{"OPTIONS", "DELETE"} {
+		trace = nil
+		resp, _ := request(createClient(), method, server.URL+"/a")
+		if resp.Header.Get("Allow") == "" || strings.Join(trace, ",") != "root" {
+			t.Error("middleware should wrap", method, resp.StatusCode, trace)
+		}
+	}
+
+	server = httptest.NewServer(routeDefinition().BuildNewRouter())
+	if s := get(createClient(), server.URL+"/broke"); s != "An error occured: "+message["broke-path"] {
+		t.Error("panic should be recovered:", s)
+	}
+}
+
+func TestURLBuilder(t *testing.T) {
+	routeDef := def.SRoute(
+		"/", home, "home-path",
+		def.SRoute("/user/{id:[0-9]+}", a, "user-path",
+			def.SRoute("/post/{slug}", b, "post-path"),
+		),
+	)
+	urls := routeDef.URLBuilder()
+
+	path, err := urls.Path("post-path", map[string]string{"id": "12", "slug": "hello"})
+	if err != nil || path != "/user/12/post/hello" {
+		t.Error("wrong path:", path, err)
+	}
+	path, err = urls.Path("post-path", struct {
+		ID   int `url:"id"`
+		Slug string
+	}{12, "hello"})
+	if err == nil {
+		t.Error("struct field names should be used as is")
+	}
+	path, err = urls.Path("post-path", &struct {
+		ID   int    `url:"id"`
+		Slug string `url:"slug"`
+	}{12, "hello"})
+	if err != nil || path != "/user/12/post/hello" {
+		t.Error("wrong path:", path, err)
+	}
+
+	u, err := urls.URL("user-path", def.URLParams{
+		Vars:     map[string]interface{}{"id": 7},
+		Query:    url.Values{"tab": {"posts"}},
+		Fragment: "top",
+	})
+	if err != nil || u.String() != "/user/7?tab=posts#top" {
+		t.Error("wrong url:", u, err)
+	}
+
+	abs, err := urls.Absolute("https://example.com/ignored")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path, _ := abs.Path("home-path", nil); path != "https://example.com/" {
+		t.Error("wrong absolute url:", path)
+	}
+	if _, err := urls.Absolute("example.com"); err == nil {
+		t.Error("base without scheme should fail")
+	}
+
+	_, err = urls.Path("post-path", map[string]string{"id": "x", "name": "joe"})
+	urlErr, ok := err.(*def.URLError)
+	if !ok || strings.Join(urlErr.Missing, ",") != "slug" ||
+		strings.Join(urlErr.Extra, ",") != "name" ||
+		strings.Join(urlErr.Invalid, ",") != "id" {
+		t.Error("wrong error:", err)
+	}
+	if _, err := urls.Path("x-path", nil); err == nil {
+		t.Error("error expected for unknown route")
+	}
+}
+
+func TestLenientUrlFn(t *testing.T) {
+	routeDef := routeDefinition()
+	strict := routeDef.CreateUrlFn()
+
+	if s, err := routeDef.CreateUrlFn(false)("x-path"); err != nil || s != "#" {
+		t.Error("lenient UrlFn should return the fallback:", s, err)
+	}
+
+	collector := new(def.UrlCollector)
+	urlfor := strict.Lenient(def.LenientOptions{
+		FallbackRoute: "home-path",
+		Collector:     collector,
+	})
+	if s, _ := urlfor("a-path"); s != "/a" {
+		t.Error("wrong url:", s)
+	}
+	if s, _ := urlfor("x-path", "id", "1"); s != "/" {
+		t.Error("fallback route expected:", s)
+	}
+	urlfor("y-path")
+	failures := collector.Failures()
+	if len(failures) != 2 || failures[0].Name != "x-path" ||
+		failures[0].Params[1] != "1" || failures[1].Err == nil {
+		t.Error("wrong failures:", failures)
+	}
+	collector.Reset()
+	if len(collector.Failures()) != 0 {
+		t.Error("collector should be empty")
+	}
+
+	tmpl := template.Must(template.New("").
+		Funcs(template.FuncMap{"url": strict.Must()}).
+		Parse(`<a href="{{url "a-path"}}">{{url "x-path"}}</a>`))
+	err := tmpl.Execute(ioutil.Discard, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid route name") {
+		t.Error("template execution should fail:", err)
+	}
+}
+
+func TestFuncMap(t *testing.T) {
+	routeDef := routeDefinition()
+	funcs := routeDef.TemplateFuncs()
+	tmpl := template.Must(template.New("").Funcs(funcs.FuncMap(nil)).Parse(
+		`{{routeName}} {{url "c-path"}} {{urlAbs "a-path"}} ` +
+			`{{isActive "a-path"}} {{isActive "d-path"}}`))
+
+	var rendered string
+	var renderErr error
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var buf strings.Builder
+		t, _ := tmpl.Clone()
+		renderErr = t.Funcs(funcs.FuncMap(r)).Execute(&buf, nil)
+		rendered = buf.String()
+	}
+	root := def.SRoute("/", handler, "home-path",
+		def.SRoute("/a", handler, "a-path",
+			def.SRoute("/b", handler, "b-path"),
+		),
+	)
+	server := httptest.NewServer(root.BuildNewRouter())
+	get(createClient(), server.URL+"/a/b")
+	expected := "b-path /a/b/c " + server.URL + "/a true false"
+	if renderErr != nil || rendered != expected {
+		t.Error("wrong render:", rendered, renderErr)
+	}
+
+	tmpl = template.Must(template.New("").Funcs(funcs.FuncMap(nil)).Parse(`{{url "x-path"}}`))
+	if err := tmpl.Execute(ioutil.Discard, nil); err == nil {
+		t.Error("invalid route should fail the template")
+	}
+	funcs.Base = "https://example.com"
+	tmpl = template.Must(template.New("").Funcs(funcs.FuncMap(nil)).Parse(`{{urlAbs "d-path"}}`))
+	var buf strings.Builder
+	if tmpl.Execute(&buf, nil); buf.String() != "https://example.com/a/d" {
+		t.Error("wrong absolute url:", buf.String())
+	}
+}
+
+func TestGenerateURLHelpers(t *testing.T) {
+	routeDef := def.SRoute(
+		"/", home, "home-path",
+		def.SRoute("/user/{id:[0-9]+}", a, "user-path",
+			def.SRoute("/post/{type}/{post-slug}", b, "post-path"),
+		),
+		def.ReSRoute("/api", "json", "user-path"),
+	)
+	src, err := def.GenerateURLHelpers(routeDef, "urls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "urls.go", src, 0)
+	if err != nil {
+		t.Fatal(err, string(src))
+	}
+	var funcs []string
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			funcs = append(funcs, fn.Name.Name)
+		}
+	}
+	if strings.Join(funcs, ",") != "URLHomePath,URLUserPath,URLPostPath,"+
+		"URLJsonUserPath,URLJsonPostPath" {
+		t.Error("wrong functions:", funcs)
+	}
+	if !strings.Contains(string(src),
+		`func URLPostPath(id string, type_ string, postSlug string) (string, error) {`) ||
+		!strings.Contains(string(src),
+			`return UrlFor("post-path", "id", id, "type", type_, "post-slug", postSlug)`) {
+		t.Error("wrong source:\n" + string(src))
+	}
+
+	src, err = def.GenerateURLHelpers(def.SRoute("/", a, "élan-path",
+		def.SRoute("/{ñame}", b, "über-path")), "urls")
+	if err != nil || !strings.Contains(string(src),
+		`func URLÜberPath(ñame string) (string, error) {`) {
+		t.Error("wrong source for multibyte names:\n"+string(src), err)
+	}
+
+	_, err = def.GenerateURLHelpers(def.SRoute("/", a, "a-path",
+		def.SRoute("/b", b, "a_path")), "urls")
+	if err == nil {
+		t.Error("name clash should be an error")
+	}
+
+	src, err = def.GenerateURLHelpers(def.SRoute("/", a, "home-path",
+		def.SRoute("/{user_id}/{userId}/{UrlFor}/{type}", b, "clash-path")), "urls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := typeCheck(src); err != nil {
+		t.Error("generated source doesn't compile:", err, "\n"+string(src))
+	}
+}
+
+// typeCheck checks generated source against a stub of the package
+func typeCheck(src []byte) error {
+	fset := token.NewFileSet()
+	stub, err := parser.ParseFile(fset, "stub.go", `package roudetef
+type UrlFn func(name string, params ...string) (string, error)`, 0)
+	if err != nil {
+		return err
+	}
+	pkg, err := new(types.Config).Check("github.com/nvlled/roudetef", fset,
+		[]*ast.File{stub}, nil)
+	if err != nil {
+		return err
+	}
+	f, err := parser.ParseFile(fset, "urls.go", src, 0)
+	if err != nil {
+		return err
+	}
+	conf := types.Config{Importer: importerFunc(func(string) (*types.Package, error) {
+		return pkg, nil
+	})}
+	_, err = conf.Check("urls", fset, []*ast.File{f}, nil)
+	return err
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+func TestGenerateTSRoutes(t *testing.T) {
+	routeDef := def.SRoute(
+		"/", home, "home-path",
+		def.SRoute(def.Methods("GET", "PUT")("/user/{id:[0-9]+}"), a, "user-path",
+			def.SRoute("/post/{post-slug}", b, "post-path"),
+		),
+	)
+	src, err := def.GenerateTSRoutes(routeDef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"export function homePath(): string {\n  return `/`;\n}",
+		"export function postPath(params: { \"id\": Param; \"post-slug\": Param }): string {\n" +
+			"  return `/user/${encodeURIComponent(String(params[\"id\"]))}/post/" +
+			"${encodeURIComponent(String(params[\"post-slug\"]))}`;\n}",
+		`"home-path": { path: "/", methods: null, url: homePath },`,
+		`"post-path": { path: "/user/{id:[0-9]+}/post/{post-slug}", methods: ["GET", "PUT"], url: postPath },`,
+		"} as const;",
+	}
+	for _, s := range expected {
+		if !strings.Contains(string(src), s) {
+			t.Error("missing from the module:", s, "\n"+string(src))
+		}
+	}
+
+	src, _ = def.GenerateJSRoutes(routeDef)
+	if strings.Contains(string(src), "Param") || strings.Contains(string(src), "as const") {
+		t.Error("javascript should have no types:\n" + string(src))
+	}
+
+	src, _ = def.GenerateJSRoutes(def.SRoute("/", a, "home-path",
+		def.SRoute(def.DELETE("/{id}"), a, "delete"),
+		def.SRoute("/routes", a, "routes"),
+	))
+	if !strings.Contains(string(src), "export function delete_(params) {") ||
+		!strings.Contains(string(src), "export function routes_() {") ||
+		!strings.Contains(string(src), `"delete": { path: "/{id}", methods: ["DELETE"], url: delete_ },`) {
+		t.Error("reserved words should get a suffix:\n" + string(src))
+	}
+
+	src, _ = def.GenerateTSRoutes(def.SRoute("/", a, "home-path",
+		def.SRoute("/{tenant}/a", a, "a-path").Host("{tenant}.example.com"),
+	))
+	if !strings.Contains(string(src), `export function aPath(params: { "tenant": Param }): string {`) {
+		t.Error("variables should be declared once:\n" + string(src))
+	}
+}
+
+var userID = def.IntParam("id")
+var postSlug = def.SlugParam("slug")
+var pageNum = def.IntParam("page").Loose()
+
+func TestParams(t *testing.T) {
+	var gotID, gotPage int
+	var gotSlug string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		gotID, _ = userID.Get(r)
+		gotSlug, _ = postSlug.Get(r)
+		gotPage, _ = pageNum.Get(r)
+	}
+	routeDef, err := def.NewRoute("home-path").Path("/").HandlerFunc(home).Sub(
+		def.NewRoute("user-path").Path("/user/{id}").HandlerFunc(handler).
+			Params(userID).
+			Sub(def.NewRoute("post-path").Path("/post/{slug}/{page}").
+				HandlerFunc(handler).Params(postSlug, pageNum)),
+		def.NewRoute("teapot-path").Path("/teapot/{id}").HandlerFunc(handler).
+			Params(userID).
+			OnParamError(func(w http.ResponseWriter, r *http.Request, err *def.ParamError) {
+				w.WriteHeader(http.StatusTeapot)
+			}),
+	).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := routeDef.Search("post-path").FullPath(); p != "/user/{id:-?[0-9]+}/post/{slug:[a-z0-9]+(?:-[a-z0-9]+)*}/{page}" {
+		t.Error("wrong path template:", p)
+	}
+
+	server := httptest.NewServer(routeDef.BuildNewRouter())
+	c := createClient()
+	expected := map[string]int{
+		"/user/12/post/hello-world/3":  http.StatusOK,
+		"/user/x/post/hello-world/3":   http.StatusNotFound,
+		"/user/12/post/Hello/3":        http.StatusNotFound,
+		"/user/12/post/hello/x":        http.StatusBadRequest,
+		"/user/99999999999999999999":   http.StatusBadRequest,
+		"/teapot/99999999999999999999": http.StatusTeapot,
+	}
+	for path, status := range expected {
+		resp, _ := c.Get(server.URL + path)
+		if resp.StatusCode != status {
+			t.Error("wrong status for", path, resp.StatusCode)
+		}
+	}
+	get(c, server.URL+"/user/12/post/hello-world/3")
+	if gotID != 12 || gotSlug != "hello-world" || gotPage != 3 {
+		t.Error("wrong params:", gotID, gotSlug, gotPage)
+	}
+
+	urls := routeDef.URLBuilder()
+	if _, err := urls.Path("user-path", map[string]interface{}{"id": 12}); err != nil {
+		t.Error(err)
+	}
+	if _, err := urls.Path("user-path", map[string]interface{}{"id": 1.5}); err == nil {
+		t.Error("wrong typed value should fail")
+	}
+	if _, err := urls.Path("post-path", map[string]interface{}{
+		"id": 1, "slug": "a", "page": "x"}); err == nil {
+		t.Error("invalid loose param should fail")
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	// like createHandler, /admin POST is handled before the tree
+	base := mux.NewRouter()
+	base.StrictSlash(true)
+	base.Path("/admin").Handler(http.HandlerFunc(c)).Methods("POST")
+
+	countRoutes := func() int {
+		n := 0
+		base.Walk(func(*mux.Route, *mux.Router, []*mux.Route) error {
+			n++
+			return nil
+		})
+		return n
+	}
+	analysis := routeDefinition().Analyze(base)
+	if countRoutes() != 1 || base.Get("home-path") != nil {
+		t.Error("the analysis shouldn't add routes to base")
+	}
+	expected := []def.Shadow{
+		{Route: "admin-path", Path: "/admin", Method: "POST", By: "/admin"},
+	}
+	if fmt.Sprint(analysis.Shadowed) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, analysis.Shadowed)
+	}
+	if len(analysis.Unreachable) > 0 || len(analysis.Overlaps) > 0 {
+		t.Error("unexpected report:\n", analysis)
+	}
+	if fmt.Sprint(analysis.Skipped) != "[submit-post]" {
+		t.Error("routes with transformers should be skipped:", analysis.Skipped)
+	}
+	if err := routeDefinition().Analyze(nil).Err(); err != nil {
+		t.Error("test server routes shouldn't shadow each other:", err)
+	}
+
+	routeDef := def.SRoute(
+		"/", home, "home",
+		def.SRoute("/user", a, "users"),
+		def.SRoute("/user/{id:[0-9]+}", b, "user"),
+		def.SRoute(def.GET("/x"), c, "x-get"),
+		def.SRoute("/x", d, "x-any"),
+	)
+	analysis = routeDef.Analyze(nil)
+	if analysis.OK() || analysis.Err() == nil {
+		t.Fatal("expected shadowed routes")
+	}
+	var shadowed []string
+	for _, s := range analysis.Shadowed {
+		shadowed = append(shadowed, s.Route+" "+s.Method+" "+s.Path+" "+s.By)
+	}
+	expectedShadowed := []string{
+		"user GET /user/0 users",
+		"user HEAD /user/0 users",
+		"user POST /user/0 users",
+		"user PUT /user/0 users",
+		"user PATCH /user/0 users",
+		"user DELETE /user/0 users",
+		"user OPTIONS /user/0 users",
+		"x-any GET /x x-get",
+	}
+	if strings.Join(shadowed, "\n") != strings.Join(expectedShadowed, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expectedShadowed, "\n"),
+			strings.Join(shadowed, "\n"))
+	}
+	if fmt.Sprint(analysis.Unreachable) != "[user]" {
+		t.Error("unexpected unreachable routes:", analysis.Unreachable)
+	}
+	expectedOverlaps := []def.Overlap{
+		{Route1: "users", Route2: "user", Methods: nil},
+		{Route1: "x-get", Route2: "x-any", Methods: def.MethodSet{"GET"}},
+	}
+	if fmt.Sprint(analysis.Overlaps) != fmt.Sprint(expectedOverlaps) {
+		t.Errorf("expected overlaps %v, got %v", expectedOverlaps, analysis.Overlaps)
+	}
+
+	// the report is the same every time
+	if routeDef.Analyze(nil).String() != analysis.String() {
+		t.Error("analysis isn't deterministic")
+	}
+}
+
+func TestExactPaths(t *testing.T) {
+	prefixRoot, _ := createHandler()
+	prefixServer := httptest.NewServer(prefixRoot)
+	defer prefixServer.Close()
+
+	exactRoot := mux.NewRouter()
+	exactRoot.StrictSlash(true)
+	exactRoot.Path("/admin").Handler(http.HandlerFunc(c)).Methods("POST")
+	def.BuildRouter(routeDefinition().Exact(), exactRoot)
+	exactServer := httptest.NewServer(exactRoot)
+	defer exactServer.Close()
+
+	c := createClient()
+	check := func(server *httptest.Server, method, path string, status int) *http.Response {
+		resp, _ := request(c, method, server.URL+path)
+		if resp.StatusCode != status {
+			t.Errorf("%s %s: expected %d, got %d", method, path, status, resp.StatusCode)
+		}
+		return resp
+	}
+
+	// leaves match any deeper path by default
+	check(prefixServer, "GET", "/logout", 200)
+	check(prefixServer, "GET", "/logoutanything", 200)
+	check(prefixServer, "GET", "/submit/more", 200)
+	// the method fallbacks match the path only
+	check(prefixServer, "DELETE", "/submit/more", 404)
+
+	check(exactServer, "GET", "/logout", 200)
+	check(exactServer, "GET", "/logoutanything", 404)
+	check(exactServer, "GET", "/submit/more", 404)
+	check(exactServer, "DELETE", "/submit/more", 404)
+	check(exactServer, "DELETE", "/submit", 405)
+	check(exactServer, "POST", "/admin", 200)
+	// with StrictSlash, the trailing slash is redirected
+	resp := check(exactServer, "GET", "/logout/", 200)
+	if resp.Request.URL.Path != "/logout" {
+		t.Error("expected a redirect to /logout, got", resp.Request.URL.Path)
+	}
+	// routes with subroutes are still prefixes
+	check(exactServer, "GET", "/", 200)
+	get(c, exactServer.URL+"/login")
+	if s := get(c, exactServer.URL+"/a/b/c"); s != message["c-path"] {
+		t.Error("unexpected response for /a/b/c:", s)
+	}
+	check(exactServer, "GET", "/a/b/cc", 404)
+
+	routeDef := def.SRoute(
+		"/", home, "home",
+		def.SRoute("/x", a, "x").Exact(false),
+		def.SRoute("/y", b, "y"),
+	).Exact()
+	for name, exact := range map[string]bool{"home": false, "x": false, "y": true} {
+		if routeDef.Search(name).IsExact() != exact {
+			t.Errorf("%s: expected exact to be %v", name, exact)
+		}
+	}
+	analysis := routeDef.Analyze(nil)
+	if !analysis.OK() || len(analysis.Overlaps) > 0 {
+		t.Error("unexpected analysis:", analysis)
+	}
+}
+
+func TestTrailingSlash(t *testing.T) {
+	routeDef := def.SRoute(
+		"/", home, "home",
+		def.SRoute("/r", a, "redirect").TrailingSlash(def.SlashRedirect),
+		def.SRoute("/n/", b, "no-slash").TrailingSlash(def.NoSlashRedirect).Exact(),
+		def.SRoute(
+			"/both", c, "both",
+			def.SRoute("/x", d, "both-x").Exact(),
+		).TrailingSlash(def.SlashBoth),
+		def.SRoute("/s", d, "strict").TrailingSlash(def.SlashStrict).Exact(),
+	)
+	// the policies take over StrictSlash
+	root := mux.NewRouter()
+	root.StrictSlash(true)
+	def.BuildRouter(routeDef, root)
+	server := httptest.NewServer(root)
+	defer server.Close()
+
+	client := createClient()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	tests := []struct {
+		path     string
+		status   int
+		location string
+		body     string
+	}{
+		{"/r", 301, "/r/", ""},
+		{"/r/", 200, "", message["a-path"]},
+		{"/n/", 301, "/n", ""},
+		{"/n", 200, "", message["b-path"]},
+		{"/both", 200, "", message["c-path"]},
+		{"/both/", 200, "", message["c-path"]},
+		{"/both/x", 200, "", message["d-path"]},
+		{"/both/x/", 200, "", message["d-path"]},
+		{"/s", 200, "", message["d-path"]},
+		{"/s/", 404, "", ""},
+	}
+	for _, test := range tests {
+		resp, body := request(client, "GET", server.URL+test.path)
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected %d, got %d", test.path, test.status, resp.StatusCode)
+		}
+		if loc := resp.Header.Get("Location"); loc != test.location {
+			t.Errorf("%s: expected redirect to %q, got %q", test.path, test.location, loc)
+		}
+		if test.body != "" && body != test.body {
+			t.Errorf("%s: unexpected body %q", test.path, body)
+		}
+	}
+
+	if routeDef.Search("both-x").SlashPolicy() != def.SlashBoth {
+		t.Error("the policy should be inherited")
+	}
+	urlFor := def.CreateUrlFn(root)
+	for name, path := range map[string]string{
+		"redirect": "/r/", "no-slash": "/n", "both": "/both", "both-x": "/both/x",
+		"strict": "/s",
+	} {
+		if fullPath := routeDef.Search(name).FullPath(); fullPath != path {
+			t.Errorf("%s: expected full path %s, got %s", name, path, fullPath)
+		}
+		if u, err := urlFor(name); err != nil || u != path {
+			t.Errorf("%s: expected url %s, got %s %v", name, path, u, err)
+		}
+	}
+
+	// the handlers set by Ts get the policies as well
+	ts := func(h http.HandlerFunc) def.HandlerT {
+		return def.With(a, def.Ts{def.H(h)})
+	}
+	routeDef = def.SRoute(
+		"/", home, "home",
+		def.SRoute("/r", ts(b), "redirect").TrailingSlash(def.SlashRedirect),
+		def.SRoute("/n", ts(b), "no-slash").TrailingSlash(def.NoSlashRedirect),
+		def.SRoute("/both", ts(b), "both").TrailingSlash(def.SlashBoth),
+		def.SRoute("/s", ts(b), "strict").TrailingSlash(def.SlashStrict),
+		def.SRoute("/s2/", ts(b), "strict-slash").TrailingSlash(def.SlashStrict),
+		def.SRoute(
+			"/p", nil, "parent",
+			def.SRoute("/n", ts(c), "inherited"),
+		).TrailingSlash(def.NoSlashRedirect),
+		def.SRoute("/d", ts(d), "default"),
+	)
+	server = httptest.NewServer(routeDef.BuildNewRouter())
+	defer server.Close()
+	tests = []struct {
+		path     string
+		status   int
+		location string
+		body     string
+	}{
+		{"/r", 301, "/r/", ""},
+		{"/r/", 200, "", message["b-path"]},
+		{"/n", 200, "", message["b-path"]},
+		{"/n/", 301, "/n", ""},
+		{"/both", 200, "", message["b-path"]},
+		{"/both/", 200, "", message["b-path"]},
+		{"/s", 200, "", message["b-path"]},
+		{"/s/", 404, "", ""},
+		{"/s2/", 200, "", message["b-path"]},
+		{"/s2", 404, "", ""},
+		{"/p/n", 200, "", message["c-path"]},
+		{"/p/n/", 301, "/p/n", ""},
+		{"/d", 301, "/d/", ""},
+		{"/d/", 200, "", message["d-path"]},
+	}
+	for _, test := range tests {
+		resp, body := request(client, "GET", server.URL+test.path)
+		if resp.StatusCode != test.status {
+			t.Errorf("Ts %s: expected %d, got %d", test.path, test.status, resp.StatusCode)
+		}
+		if loc := resp.Header.Get("Location"); loc != test.location {
+			t.Errorf("Ts %s: expected redirect to %q, got %q", test.path, test.location, loc)
+		}
+		if test.body != "" && body != test.body {
+			t.Errorf("Ts %s: unexpected body %q", test.path, body)
+		}
+	}
+}
+
+func TestHost(t *testing.T) {
+	routeDef := def.SRoute(
+		"/", nil, "root",
+		def.SRoute(
+			"/", home, "site",
+			def.SRoute("/a", a, "a"),
+		).Host("www.example.com"),
+		def.ReSRoute("", "api", "site").Host("api.example.com"),
+		def.SRoute(
+			"/t", b, "tenant",
+			def.SRoute("/{page}", c, "tenant-page"),
+		).Host("{tenant}.example.com"),
+	)
+	if err := routeDef.Validate(); err != nil {
+		t.Error("routes with different hosts shouldn't conflict:", err)
+	}
+	if err := routeDef.Analyze(nil).Err(); err != nil {
+		t.Error(err)
+	}
+	router := routeDef.BuildNewRouter()
+
+	tests := []struct {
+		host, path string
+		body       string
+	}{
+		{"www.example.com", "/a", message["a-path"]},
+		{"api.example.com", "/a", message["a-path"]},
+		{"acme.example.com", "/t/x", message["c-path"]},
+		{"acme.example.com", "/a", ""},
+		{"example.org", "/a", ""},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", test.path, nil)
+		req.Host = test.host
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if test.body == "" && w.Code != http.StatusNotFound {
+			t.Errorf("%s%s: expected 404, got %d", test.host, test.path, w.Code)
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s%s: unexpected body %q", test.host, test.path, w.Body.String())
+		}
+	}
+
+	table := routeDef.Table()
+	expected := []def.Entry{
+		{"root", "/", "ANY"},
+		{"site", "www.example.com/", "ANY"},
+		{"a", "www.example.com/a", "ANY"},
+		{"api/site", "api.example.com/", "ANY"},
+		{"api/a", "api.example.com/a", "ANY"},
+		{"tenant", "{tenant}.example.com/t", "ANY"},
+		{"tenant-page", "{tenant}.example.com/t/{page}", "ANY"},
+	}
+	if !sameTable(table, expected) {
+		t.Errorf("unexpected table:\n%v", routeDef)
+	}
+
+	urlFor := def.CreateUrlFn(router)
+	if u, err := urlFor("api/a"); u != "http://api.example.com/a" {
+		t.Error("unexpected url", u, err)
+	}
+	if u, err := urlFor("tenant-page", "tenant", "acme", "page", "x"); u != "http://acme.example.com/t/x" {
+		t.Error("unexpected url", u, err)
+	}
+	urls := routeDef.URLBuilder()
+	vars := map[string]string{"tenant": "acme", "page": "x"}
+	if u, err := urls.Path("tenant-page", vars); u != "http://acme.example.com/t/x" {
+		t.Error("unexpected url", u, err)
+	}
+	if _, err := urls.Path("tenant-page", map[string]string{"tenant": "a.b", "page": "x"}); err == nil {
+		t.Error("a host variable can't have dots")
+	}
+	secure, _ := urls.Absolute("https://example.org")
+	if u, err := secure.Path("a", nil); u != "https://www.example.com/a" {
+		t.Error("unexpected url", u, err)
+	}
+
+	funcs := routeDef.TemplateFuncs()
+	funcs.Base = "http://example.org"
+	tmpl := template.Must(template.New("").Funcs(funcs.FuncMap(nil)).Parse(
+		`{{urlAbs "tenant-page" "tenant" "acme" "page" "x"}}`))
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, nil); err != nil || buf.String() != "http://acme.example.com/t/x" {
+		t.Error("wrong absolute url:", buf.String(), err)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	routeDef := def.SRoute(
+		"/", home, "home",
+		def.SRoute("/search", def.With(a, def.Queries("type", "user")), "search-users"),
+		def.SRoute(
+			"/search",
+			def.With(b, def.Queries("type", "post", "page", "{page:[0-9]+}")),
+			"search-posts",
+		),
+		def.SRoute("/text", def.With(c, def.HeadersRegexp("Accept", "^text/")), "text"),
+		def.SRoute(
+			"/secret",
+			def.With(d, def.MatcherFunc(func(r *http.Request) bool {
+				return r.URL.Query().Get("key") == "1"
+			})),
+			"secret",
+		),
+	)
+	router := routeDef.BuildNewRouter()
+
+	tests := []struct {
+		path, accept string
+		body         string
+	}{
+		{"/search?type=user", "", message["a-path"]},
+		{"/search?type=post&page=2", "", message["b-path"]},
+		{"/search?type=post", "", ""},
+		{"/search?type=post&page=x", "", ""},
+		{"/text", "text/html", message["c-path"]},
+		{"/text", "application/json", ""},
+		{"/secret?key=1", "", message["d-path"]},
+		{"/secret", "", ""},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", test.path, nil)
+		req.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if test.body == "" && w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", test.path, w.Code)
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s: unexpected body %q", test.path, w.Body.String())
+		}
+	}
+
+	funcs := routeDef.TemplateFuncs()
+	funcs.Base = "http://example.com"
+	tmpl := template.Must(template.New("").Funcs(funcs.FuncMap(nil)).Parse(
+		`{{url "search-users"}} {{urlAbs "search-users"}}`))
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, nil); err != nil ||
+		buf.String() != "/search?type=user http://example.com/search?type=user" {
+		t.Error("wrong urls:", buf.String(), err)
+	}
+
+	table := routeDef.Table()
+	expected := []def.Entry{
+		{"home", "/", "ANY"},
+		{"search-users", "/search?type=user", "ANY"},
+		{"search-posts", "/search?type=post&page={page:[0-9]+}", "ANY"},
+		{"text", "/text", "ANY"},
+		{"secret", "/secret", "ANY"},
+	}
+	if !sameTable(table, expected) {
+		t.Errorf("unexpected table:\n%v", routeDef)
+	}
+
+	urlFor := def.CreateUrlFn(router)
+	if u, err := urlFor("search-users"); u != "/search?type=user" {
+		t.Error("unexpected url", u, err)
+	}
+	if u, err := urlFor("search-posts", "page", "2"); u != "/search?type=post&page=2" {
+		t.Error("unexpected url", u, err)
+	}
+	urls := routeDef.URLBuilder()
+	u, err := urls.URL("search-posts", def.URLParams{
+		Vars:  map[string]int{"page": 2},
+		Query: url.Values{"q": {"go"}, "type": {"user"}},
+	})
+	if err != nil || u.String() != "/search?type=post&page=2&q=go" {
+		t.Error("unexpected url", u, err)
+	}
+	if _, err := urls.Path("search-posts", map[string]string{"page": "x"}); err == nil {
+		t.Error("expected an invalid page")
+	}
+
+	src, err := def.GenerateTSRoutes(routeDef)
+	if err != nil || !strings.Contains(string(src),
+		"`/search?type=post&page=${encodeURIComponent(String(params[\"page\"]))}`") {
+		t.Errorf("unexpected TS routes %v:\n%s", err, src)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	userJSON := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"user":1}`)
+	}
+	routeDef := def.SRoute(
+		"/", home, "home",
+		def.SRoute("/user", def.Negotiate(
+			def.As("text/html", a),
+			def.As("application/json", userJSON),
+		).Consumes("application/json", "application/x-www-form-urlencoded"), "user"),
+		def.SRoute("/json", def.Negotiate(def.As("application/json", userJSON)).
+			OnNotAcceptable(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotAcceptable)
+				fmt.Fprint(w, "json only")
+			}), "json"),
+		def.SRoute(def.POST("/upload"), def.With(c, def.ContentType("image/*")), "upload"),
+		def.SRoute("/feed", def.With(d, def.Accept("application/rss+xml")), "feed"),
+		def.SRoute(def.POST("/avatar"), def.With(c, def.ContentType("image/png").
+			OnUnsupportedMediaType(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				fmt.Fprint(w, "png only")
+			})), "avatar"),
+		def.SRoute("/atom", def.With(b, def.Accept("application/atom+xml").
+			OnNotAcceptable(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotAcceptable)
+				fmt.Fprint(w, "atom only")
+			})), "atom"),
+		def.SRoute("/atom", def.With(d, def.Accept("application/rss+xml")), "rss"),
+	)
+	router := routeDef.BuildNewRouter()
+
+	tests := []struct {
+		method, path, accept, contentType string
+		status                            int
+		body                              string
+	}{
+		{"GET", "/user", "", "", 200, message["a-path"]},
+		{"GET", "/user", "application/json", "", 200, `{"user":1}`},
+		{"GET", "/user", "text/html;q=0.5, application/json", "", 200, `{"user":1}`},
+		{"GET", "/user", "text/*;q=0.9, */*;q=0.1", "", 200, message["a-path"]},
+		{"GET", "/user", "application/*, text/html;q=0", "", 200, `{"user":1}`},
+		{"GET", "/user", "text/html, application/json", "", 200, message["a-path"]},
+		{"GET", "/user", "image/png", "", 406, ""},
+		{"POST", "/user", "", "application/json", 200, message["a-path"]},
+		{"POST", "/user", "", "text/plain", 415, ""},
+		{"GET", "/json", "text/html", "", 406, "json only"},
+		{"POST", "/upload", "", "image/png", 200, message["c-path"]},
+		{"POST", "/upload", "", "text/plain", 415, ""},
+		{"PUT", "/upload", "", "image/png", 405, ""},
+		{"GET", "/feed", "application/rss+xml", "", 200, message["d-path"]},
+		{"GET", "/feed", "text/html", "", 406, ""},
+		{"GET", "/feed/more", "text/html", "", 404, ""},
+		{"POST", "/avatar", "", "image/gif", 415, "png only"},
+		{"GET", "/atom", "application/rss+xml", "", 200, message["d-path"]},
+		{"GET", "/atom", "text/html", "", 406, "atom only"},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.path, strings.NewReader("x"))
+		if test.method == "GET" {
+			req, _ = http.NewRequest(test.method, test.path, nil)
+		}
+		req.Header.Set("Accept", test.accept)
+		req.Header.Set("Content-Type", test.contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		desc := fmt.Sprintf("%s %s (Accept: %s, Content-Type: %s)",
+			test.method, test.path, test.accept, test.contentType)
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d", desc, test.status, w.Code)
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s: unexpected body %q", desc, w.Body.String())
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/user", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Header().Get("Content-Type") != "application/json" ||
+		w.Header().Get("Vary") != "Accept" {
+		t.Error("unexpected headers", w.Header())
+	}
+}
+
+func TestVersions(t *testing.T) {
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)
+	say := func(s string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, s)
+		}
+	}
+	routeDef := def.SRoute(
+		"/", nil, "root",
+		def.Version("v1", "api").Deprecate(since).Sunset(sunset).
+			Override("user", say("user v1")).
+			Remove("search"),
+		def.Version("v2", "api"),
+		def.Version("beta", "api").ByHeader().Override("user", say("user beta")),
+		def.SRoute(
+			"/api", nil, "api",
+			def.SRoute("/user", say("user"), "user"),
+			def.SRoute("/search", say("search"), "search"),
+		),
+	)
+	if err := routeDef.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	router := routeDef.BuildNewRouter()
+
+	tests := []struct {
+		path, version string
+		body          string
+		deprecated    bool
+	}{
+		{"/v1/api/user", "", "user v1", true},
+		{"/v1/api/search", "", "", true},
+		{"/v2/api/user", "", "user", false},
+		{"/v2/api/search", "", "search", false},
+		{"/api/user", "beta", "user beta", false},
+		{"/api/user", "", "user", false},
+		{"/api/search", "beta", "search", false},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", test.path, nil)
+		if test.version != "" {
+			req.Header.Set("Accept-Version", test.version)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if test.body == "" {
+			if w.Code != http.StatusNotFound {
+				t.Errorf("%s: expected 404, got %d", test.path, w.Code)
+			}
+			continue
+		}
+		if w.Body.String() != test.body {
+			t.Errorf("%s (%s): expected %q, got %q", test.path, test.version,
+				test.body, w.Body.String())
+		}
+		deprecation := w.Header().Get("Deprecation")
+		if test.deprecated && (deprecation != "@1767225600" ||
+			w.Header().Get("Sunset") != "Thu, 31 Dec 2026 00:00:00 GMT") {
+			t.Errorf("%s: missing deprecation headers: %v", test.path, w.Header())
+		}
+		if !test.deprecated && deprecation != "" {
+			t.Errorf("%s: unexpected deprecation header", test.path)
+		}
+	}
+
+	// the header needs a date
+	undated := def.SRoute("/", nil, "root",
+		def.Version("v1", "api").Deprecate(time.Time{}),
+		def.SRoute("/api", say("api"), "api"),
+	)
+	w := httptest.NewRecorder()
+	undated.BuildNewRouter().ServeHTTP(w, httptest.NewRequest("GET", "/v1/api", nil))
+	if w.Body.String() != "api" || w.Header()["Deprecation"] != nil {
+		t.Error("no deprecation header expected without a date:", w.Header())
+	}
+
+	var groups []string
+	for _, table := range routeDef.VersionTables() {
+		name := "-"
+		if table.Version != nil {
+			name = table.Version.Name()
+		}
+		var names []string
+		for _, entry := range table.Entries {
+			names = append(names, entry.Name)
+		}
+		groups = append(groups, name+": "+strings.Join(names, " "))
+	}
+	expected := []string{
+		"-: root api user search",
+		"v1: v1/api v1/user",
+		"v2: v2/api v2/user v2/search",
+		"beta: beta/api beta/user beta/search",
+	}
+	if strings.Join(groups, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected groups:\n%s", strings.Join(groups, "\n"))
+	}
+	s := routeDef.String()
+	for _, heading := range []string{
+		"\n[v1] deprecated, sunset 2026-12-31\n",
+		"\n[v2]\n",
+		"\n[beta] Accept-Version: beta\n",
+	} {
+		if !strings.Contains(s, heading) {
+			t.Errorf("missing heading %q in\n%s", heading, s)
+		}
+	}
+
+	routeDef = def.SRoute(
+		"/", nil, "root",
+		def.Version("v1", "api").Override("nope", a).Remove("api"),
+		def.SRoute("/api", a, "api"),
+	)
+	err := routeDef.Validate()
+	if err == nil || len(err.(def.Errors)) != 2 {
+		t.Fatal("expected two errors, got", err)
+	}
+	for _, e := range err.(def.Errors) {
+		if e.(*def.ValidationError).Kind != def.UnknownVersionRoute {
+			t.Error("unexpected error", e)
+		}
+	}
+}
+
+func TestReRoutes(t *testing.T) {
+	say := func(s string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, s)
+		}
+	}
+	api := def.SRoute(
+		"/api", nil, "api",
+		def.SRoute("/user", say("user"), "user"),
+	)
+	routeDef := def.SRoute(
+		"/", nil, "root",
+		def.SRoute(
+			"/admin", nil, "admin",
+			def.SRoute(
+				"/tools", nil, "tools",
+				def.ReSRoute("/shared", "shared", "common"),
+			),
+		),
+		def.SRoute("/common", say("common"), "common"),
+		def.SRoute(
+			"/v1", nil, "v1",
+			def.ReSRoute("", "ext", "user").From(api),
+		),
+	)
+	if err := routeDef.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []def.Entry{
+		{"root", "/", "ANY"},
+		{"admin", "/admin", "ANY"},
+		{"tools", "/admin/tools", "ANY"},
+		{"shared/common", "/admin/tools/shared/common", "ANY"},
+		{"common", "/common", "ANY"},
+		{"v1", "/v1", "ANY"},
+		{"ext/user", "/v1/user", "ANY"},
+	}
+	if !sameTable(routeDef.Table(), expected) {
+		t.Error("unexpected table:\n" + routeDef.String())
+	}
+	server := httptest.NewServer(routeDef.BuildNewRouter())
+	defer server.Close()
+	client := createClient()
+	if get(client, server.URL+"/admin/tools/shared/common") != "common" {
+		t.Error("re-route of an ancestor's sibling not served")
+	}
+	if get(client, server.URL+"/v1/user") != "user" {
+		t.Error("re-route from another tree not served")
+	}
+
+	routeDef = def.SRoute(
+		"/", nil, "root",
+		def.SRoute(
+			"/a", nil, "a-path",
+			def.ReSRoute("/again", "again", "a-path"),
+			def.SRoute("/b", b, "b-path", def.ReSRoute("/up", "up", "root")),
+		),
+	)
+	errs, ok := routeDef.Validate().(def.Errors)
+	if !ok || len(errs) != 2 {
+		t.Fatal("expected two cycles, got", errs)
+	}
+	for _, err := range errs {
+		if err.(*def.ValidationError).Kind != def.ReRouteCycle {
+			t.Error("unexpected error", err)
+		}
+	}
+
+	routeDef = def.SRoute(
+		"/", nil, "root",
+		def.SRoute("/x", say("x"), "x", def.ReSRoute("/y", "y", "y")),
+		def.SRoute("/y", say("y"), "y", def.ReSRoute("/x", "x", "x")),
+	)
+	errs, ok = routeDef.Validate().(def.Errors)
+	if !ok || len(errs) != 1 || errs[0].(*def.ValidationError).Kind != def.ReRouteCycle {
+		t.Fatal("expected the mutual cycle once, got", errs)
+	}
+
+	routeDef = def.SRoute(
+		"/", nil, "root",
+		def.SRoute("/deep", nil, "deep", def.SRoute("/w", say("deep"), "w")),
+		def.ReSRoute("/r", "r", "w"),
+		def.SRoute("/w", say("sibling"), "w"),
+	)
+	server = httptest.NewServer(routeDef.BuildNewRouter())
+	defer server.Close()
+	if body := get(client, server.URL+"/r/w"); body != "sibling" {
+		t.Error("expected the sibling before a deeper route, got", body)
+	}
+
+	_, err := def.NewRoute("root").Path("/").Sub(
+		def.NewRoute("x").Path("/x").Sub(def.ReSRoute("/y", "y", "y-path")),
+		def.NewRoute("y-path").Path("/y").HandlerFunc(a),
+	).Build()
+	if err != nil {
+		t.Error("re-route resolved by the root was reported", err)
+	}
+}
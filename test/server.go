@@ -111,18 +111,21 @@ func noDiarrhea(r *ht.Request) bool {
 	return s.Values["hasDiarrhea"] == nil
 }
 
-func catchError(handler ht.HandlerFunc) ht.HandlerFunc {
-	return func(w ht.ResponseWriter, r *ht.Request) {
-		defer func() {
-			if err := recover(); err != nil {
-				fmt.Fprintf(w, "An error occured: %v", err)
-			}
-		}()
-		handler(w, r)
-	}
+var catchError = def.Recover(func(w ht.ResponseWriter, r *ht.Request, err interface{}) {
+	fmt.Fprintf(w, "An error occured: %v", err)
+})
+
+func hasInternalKey(r *ht.Request) bool {
+	return r.Header.Get("X-Api-Key") == "internal"
+}
+
+var allowInternal = def.Guard{
+	Name:   "allow-internal",
+	Accept: hasInternalKey,
 }
 
 var requireLogin = def.Guard{
+	Name:   "require-login",
 	Reject: notLoggedIn,
 	Handler: func(w ht.ResponseWriter, r *ht.Request) {
 		w.WriteHeader(ht.StatusUnauthorized)
@@ -131,6 +134,7 @@ var requireLogin = def.Guard{
 }
 
 var requireAdmin = def.Guard{
+	Name:   "require-admin",
 	Reject: notAdmin,
 	Handler: func(w ht.ResponseWriter, r *ht.Request) {
 		w.WriteHeader(ht.StatusUnauthorized)
@@ -139,6 +143,7 @@ var requireAdmin = def.Guard{
 }
 
 var requireDiarrhea = def.Guard{
+	Name:   "require-diarrhea",
 	Reject: noDiarrhea,
 	Handler: func(w ht.ResponseWriter, r *ht.Request) {
 		w.Header()["Content-Type"] = []string{"text/html"}
@@ -163,7 +168,7 @@ func routeDefinition() *def.RouteDef {
 
 		def.SRoute("/login", login, "login-path"),
 		def.SRoute("/logout", logout, "logout-path"),
-		def.SRoute("/broke", catchError(broke), "broke-path"),
+		def.SRoute("/broke", broke, "broke-path"),
 
 		def.SRoute(
 			def.GET("/submit"),
@@ -186,7 +191,7 @@ func routeDefinition() *def.RouteDef {
 		def.Route(
 			"/a", a, "a-path",
 			def.Hooks(),
-			def.Guards(requireLogin),
+			def.Guards(allowInternal, requireLogin),
 
 			def.SRoute(
 				"/b", b, "b-path",
@@ -197,7 +202,7 @@ func routeDefinition() *def.RouteDef {
 				def.Hooks(), def.Guards(requireDiarrhea),
 			),
 		),
-	)
+	).Use(catchError)
 }
 
 func createHandler() (*mux.Router, *def.RouteDef) {
@@ -0,0 +1,252 @@
+package roudetef
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// URLBuilder creates URLs for the routes of a RouteDef,
+// without building a mux.Router. Unlike UrlFn, path variables
+// are passed by name, in a map or a struct:
+//
+//	urls := routeDef.URLBuilder()
+//	u, err := urls.URL("user-path", def.URLParams{
+//		Vars:  map[string]string{"id": "123"},
+//		Query: url.Values{"tab": {"posts"}},
+//	})
+//
+// The URLs of routes with a host are absolute, with the http
+// scheme unless another is set by Absolute.
+type URLBuilder struct {
+	routes map[string]*RouteDef
+	base   *url.URL
+}
+
+type URLParams struct {
+	// a map with string keys, or a struct whose fields are named
+	// by their url tag, e.g. `url:"id"`, or by their field name
+	Vars     interface{}
+	Query    url.Values
+	Fragment string
+}
+
+// URLError reports why a URL couldn't be built.
+type URLError struct {
+	Route   string
+	Msg     string
+	Missing []string
+	Extra   []string
+	Invalid []string
+}
+
+func (e *URLError) Error() string {
+	msgs := []string{}
+	if e.Msg != "" {
+		msgs = append(msgs, e.Msg)
+	}
+	if len(e.Missing) > 0 {
+		msgs = append(msgs, "missing vars "+strings.Join(e.Missing, ","))
+	}
+	if len(e.Extra) > 0 {
+		msgs = append(msgs, "unknown vars "+strings.Join(e.Extra, ","))
+	}
+	if len(e.Invalid) > 0 {
+		msgs = append(msgs, "invalid values for "+strings.Join(e.Invalid, ","))
+	}
+	return fmt.Sprintf("url for route %q: %s", e.Route, strings.Join(msgs, "; "))
+}
+
+func NewURLBuilder(routeDef *RouteDef) *URLBuilder {
+	routes := make(map[string]*RouteDef)
+	routeDef.Iter(func(r *RouteDef) {
+		if _, ok := routes[r.Name]; !ok {
+			routes[r.Name] = r
+		}
+	})
+	return &URLBuilder{routes: routes}
+}
+
+func (r *RouteDef) URLBuilder() *URLBuilder {
+	return NewURLBuilder(r)
+}
+
+// Absolute returns a builder that makes absolute URLs
+// with the scheme and host of base, e.g. "https://example.com".
+func (b *URLBuilder) Absolute(base string) (*URLBuilder, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("base url %q needs a scheme and a host", base)
+	}
+	return &URLBuilder{b.routes, &url.URL{Scheme: u.Scheme, Host: u.Host}}, nil
+}
+
+// Path returns the path of the named route.
+func (b *URLBuilder) Path(name string, vars interface{}) (string, error) {
+	u, err := b.URL(name, URLParams{Vars: vars})
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (b *URLBuilder) URL(name string, params URLParams) (*url.URL, error) {
+	r, ok := b.routes[name]
+	if !ok {
+		return nil, &URLError{Route: name, Msg: "invalid route name"}
+	}
+	raw, err := varsMap(params.Vars)
+	if err != nil {
+		return nil, &URLError{Route: name, Msg: err.Error()}
+	}
+	vars := make(map[string]string)
+	for k, v := range raw {
+		vars[k] = fmt.Sprint(v)
+	}
+	// the host, the path, and the values of the query pairs
+	// share the vars
+	host := r.FullHost()
+	tmpls := []string{hostTemplate(host), r.FullPath()}
+	pairs := r.QueryPairs()
+	for i := 1; i < len(pairs); i += 2 {
+		tmpls = append(tmpls, explicitPatterns(pairs[i], ".*"))
+	}
+	expanded, err := expandTemplates(name, tmpls, vars)
+	if err != nil {
+		return nil, err
+	}
+	// declared params also check the type of the values
+	for _, p := range r.ParamChain() {
+		if v, ok := raw[p.Name()]; ok {
+			if err := p.check(v); err != nil {
+				return nil, &URLError{Route: name, Msg: err.Error(),
+					Invalid: []string{p.Name()}}
+			}
+		}
+	}
+
+	u := &url.URL{Path: expanded[1], Fragment: params.Fragment}
+	// the query pairs of the route come first, in their order
+	var query []string
+	extra := url.Values{}
+	for k, vs := range params.Query {
+		extra[k] = vs
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		query = append(query, url.QueryEscape(pairs[i])+"="+
+			url.QueryEscape(expanded[2+i/2]))
+		extra.Del(pairs[i])
+	}
+	if len(extra) > 0 {
+		query = append(query, extra.Encode())
+	}
+	u.RawQuery = strings.Join(query, "&")
+	if host != "" {
+		u.Scheme, u.Host = "http", expanded[0]
+	}
+	if b.base != nil {
+		u.Scheme = b.base.Scheme
+		if host == "" {
+			u.Host = b.base.Host
+		}
+	}
+	return u, nil
+}
+
+// expandTemplates replaces the variables of mux templates
+// that share the same vars, checking the values against
+// their patterns.
+func expandTemplates(name string, tmpls []string, vars map[string]string) ([]string, error) {
+	urlErr := &URLError{Route: name}
+	used := make(map[string]bool)
+	var expanded []string
+	for _, tmpl := range tmpls {
+		parts, err := parseTemplate(tmpl)
+		if err != nil {
+			return nil, &URLError{Route: name, Msg: err.Error()}
+		}
+		var s []string
+		for _, p := range parts {
+			if !p.isVar() {
+				s = append(s, p.literal)
+				continue
+			}
+			used[p.name] = true
+			v, ok := vars[p.name]
+			if !ok {
+				urlErr.Missing = append(urlErr.Missing, p.name)
+				continue
+			}
+			if !matchVar(p.pattern, v) {
+				urlErr.Invalid = append(urlErr.Invalid, p.name)
+			}
+			s = append(s, v)
+		}
+		expanded = append(expanded, strings.Join(s, ""))
+	}
+	for k := range vars {
+		if !used[k] {
+			urlErr.Extra = append(urlErr.Extra, k)
+		}
+	}
+	sort.Strings(urlErr.Extra)
+
+	if len(urlErr.Missing)+len(urlErr.Extra)+len(urlErr.Invalid) > 0 {
+		return nil, urlErr
+	}
+	return expanded, nil
+}
+
+// same default pattern as mux
+func matchVar(pattern, value string) bool {
+	if pattern == "" {
+		pattern = "[^/]+"
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	return err == nil && re.MatchString(value)
+}
+
+func varsMap(vars interface{}) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	if vars == nil {
+		return m, nil
+	}
+	v := reflect.ValueOf(vars)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("vars map must have string keys")
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			m[iter.Key().String()] = iter.Value().Interface()
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := f.Name
+			if tag := f.Tag.Get("url"); tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+			m[name] = v.Field(i).Interface()
+		}
+	default:
+		return nil, fmt.Errorf("vars must be a map or a struct, not %v", v.Type())
+	}
+	return m, nil
+}
@@ -0,0 +1,84 @@
+package roudetef
+
+import (
+	"sync"
+)
+
+// LenientOptions sets what a lenient UrlFn returns instead of an error.
+type LenientOptions struct {
+	// returned when the URL can't be created, defaults to "#"
+	Fallback string
+	// if set, the URL of this route is returned instead of Fallback
+	FallbackRoute string
+	// if set, records every failure
+	Collector *UrlCollector
+}
+
+type UrlFailure struct {
+	Name   string
+	Params []string
+	Err    error
+}
+
+// UrlCollector records the failures of lenient UrlFns, e.g. during
+// a template render, so that tests can check there were none.
+// It is safe for concurrent use.
+type UrlCollector struct {
+	mu       sync.Mutex
+	failures []UrlFailure
+}
+
+func (c *UrlCollector) add(f UrlFailure) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = append(c.failures, f)
+}
+
+func (c *UrlCollector) Failures() []UrlFailure {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]UrlFailure{}, c.failures...)
+}
+
+func (c *UrlCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = nil
+}
+
+// Lenient returns a UrlFn that never returns an error, for use in
+// templates where a broken link is better than a failed render.
+func (urlfn UrlFn) Lenient(opts LenientOptions) UrlFn {
+	fallback := opts.Fallback
+	if fallback == "" {
+		fallback = "#"
+	}
+	return func(name string, params ...string) (string, error) {
+		s, err := urlfn(name, params...)
+		if err == nil {
+			return s, nil
+		}
+		if opts.Collector != nil {
+			opts.Collector.add(UrlFailure{name, params, err})
+		}
+		if opts.FallbackRoute != "" {
+			if s, err := urlfn(opts.FallbackRoute); err == nil {
+				return s, nil
+			}
+		}
+		return fallback, nil
+	}
+}
+
+// Must returns a function that panics instead of returning an error.
+// Template functions that panic make the template execution
+// fail with the error, so Must suits html/template FuncMaps.
+func (urlfn UrlFn) Must() func(name string, params ...string) string {
+	return func(name string, params ...string) string {
+		s, err := urlfn(name, params...)
+		if err != nil {
+			panic(err)
+		}
+		return s
+	}
+}
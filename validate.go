@@ -0,0 +1,182 @@
+package roudetef
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	ht "net/http"
+	"strings"
+)
+
+type ValidationKind int
+
+const (
+	DuplicateName ValidationKind = iota
+	UnresolvedReRoute
+	PathConflict
+	BadPathTemplate
+	BadMethod
+	NilHandler
+	UnknownVersionRoute
+	ReRouteCycle
+)
+
+var validationKindNames = map[ValidationKind]string{
+	DuplicateName:       "duplicate name",
+	UnresolvedReRoute:   "unresolved re-route",
+	PathConflict:        "path conflict",
+	BadPathTemplate:     "bad path template",
+	BadMethod:           "bad method",
+	NilHandler:          "nil handler",
+	UnknownVersionRoute: "unknown version route",
+	ReRouteCycle:        "re-route cycle",
+}
+
+func (k ValidationKind) String() string {
+	return validationKindNames[k]
+}
+
+type ValidationError struct {
+	Kind  ValidationKind
+	Route string
+	Path  string
+	Msg   string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%v: route %q (%s): %s", e.Kind, e.Route, e.Path, e.Msg)
+}
+
+func (r *RouteDef) Validate() error {
+	return Validate(r)
+}
+
+// Validate checks the whole route tree and returns every problem
+// found as an Errors of *ValidationError, or nil.
+//
+// Two routes conflict when they have the same full path and host,
+// and share a method. Routes with transformers, or under a route
+// with transformers, are not checked for conflicts since the
+// transformers may tell them apart.
+func Validate(routeDef *RouteDef) error {
+	var errs Errors
+	report := func(kind ValidationKind, r *RouteDef, format string, args ...interface{}) {
+		errs = append(errs, &ValidationError{
+			Kind:  kind,
+			Route: r.Name,
+			Path:  r.FullPath(),
+			Msg:   fmt.Sprintf(format, args...),
+		})
+	}
+
+	names := make(map[string]*RouteDef)
+	var seen []*RouteDef
+
+	routeDef.Iter(func(r *RouteDef) {
+		if r.Name != "" {
+			if other, ok := names[r.Name]; ok {
+				report(DuplicateName, r, "name is also used by %s", other.FullPath())
+			} else {
+				names[r.Name] = r
+			}
+		}
+
+		for _, problem := range r.problems {
+			errs = append(errs, problem)
+		}
+
+		for _, p := range r.unresolved {
+			report(UnresolvedReRoute, r, "destination %q not found", p.reroute.destName)
+		}
+
+		if err := mux.NewRouter().Path(r.FullPath()).GetError(); err != nil {
+			report(BadPathTemplate, r, "%v", err)
+		}
+		if r.host != "" {
+			if err := mux.NewRouter().Host(r.host).GetError(); err != nil {
+				report(BadPathTemplate, r, "host: %v", err)
+			}
+		}
+
+		if r.Handler == nil && len(r.subroutes) == 0 && !setsHandler(r) {
+			report(NilHandler, r, "leaf route has no handler")
+		}
+
+		if !hasTransformer(r) {
+			for _, other := range seen {
+				if other.FullPath() != r.FullPath() ||
+					other.FullHost() != r.FullHost() {
+					continue
+				}
+				if ms := sharedMethods(other.methods, r.methods); ms != "" {
+					report(PathConflict, r, "%s is also handled by %q",
+						ms, other.Name)
+				}
+			}
+			seen = append(seen, r)
+		}
+	})
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// BuildRouterStrict is like BuildRouter, but the route tree
+// is validated first and nothing is built if it is invalid.
+func BuildRouterStrict(routeDef *RouteDef, base *mux.Router) (*mux.Router, error) {
+	if err := Validate(routeDef); err != nil {
+		return nil, err
+	}
+	return BuildRouter(routeDef, base), nil
+}
+
+func (r *RouteDef) BuildRouterStrict(base *mux.Router) (*mux.Router, error) {
+	return BuildRouterStrict(r, base)
+}
+
+// nil methods match any method
+func sharedMethods(ms1, ms2 []string) string {
+	if ms1 == nil {
+		return stringMethods(ms2)
+	}
+	if ms2 == nil {
+		return stringMethods(ms1)
+	}
+	var shared []string
+	for _, m1 := range ms1 {
+		for _, m2 := range ms2 {
+			if strings.EqualFold(m1, m2) {
+				shared = append(shared, m1)
+			}
+		}
+	}
+	return strings.Join(shared, ",")
+}
+
+// setsHandler tells if the transformer of the route sets a handler,
+// like H does, by applying it to a throwaway route
+func setsHandler(r *RouteDef) bool {
+	if r.transformer == nil {
+		return false
+	}
+	set := false
+	transform(r.transformer, mux.NewRouter().NewRoute(), r.slash, true,
+		func(h ht.HandlerFunc) ht.HandlerFunc {
+			set = true
+			return h
+		})
+	return set
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c > 127 || c <= ' ' || strings.ContainsRune("()<>@,;:\\\"/[]?={}", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,240 @@
+package roudetef
+
+import (
+	"fmt"
+	ht "net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The header that selects a version mounted with ByHeader.
+const VersionHeader = "Accept-Version"
+
+// A VersionDef is a re-route of a route for an API version.
+// The copy of the routes is mounted under /name, with the names
+// prefixed by name/, like json/a-path for ReRoute, or under the same
+// path if ByHeader is set:
+//
+//	def.SRoute("/", nil, "root",
+//		def.Version("v1", "api").Deprecate(since).Sunset(sunset).
+//			Override("user-path", userV1).
+//			Remove("search-path"),
+//		def.Version("v2", "api"),
+//		def.SRoute("/api", nil, "api", ...),
+//	)
+type VersionDef struct {
+	name       string
+	reroute    *ReRouteDef
+	header     bool
+	deprecated bool
+	since      time.Time
+	sunset     time.Time
+	overrides  map[string]ht.HandlerFunc
+	removed    []string
+}
+
+func Version(name string, destName string) *VersionDef {
+	return &VersionDef{
+		name:      name,
+		reroute:   ReSRoute("/"+name, name, destName),
+		overrides: make(map[string]ht.HandlerFunc),
+	}
+}
+
+func (v *VersionDef) SubRouteDef() {}
+
+func (v *VersionDef) Name() string {
+	return v.name
+}
+
+// ByHeader mounts the version under the path of the destination,
+// for the requests with an Accept-Version header set to the name
+// of the version. Since the destination matches the same paths,
+// the version must come before it.
+func (v *VersionDef) ByHeader() *VersionDef {
+	v.header = true
+	v.reroute.pathPrefix = ""
+	return v
+}
+
+// Override replaces the handler of a route of the version,
+// routeName being the name of the route in the destination.
+func (v *VersionDef) Override(routeName string, handler ht.HandlerFunc) *VersionDef {
+	v.overrides[routeName] = handler
+	return v
+}
+
+// Remove leaves routes, and their subroutes, out of the version.
+func (v *VersionDef) Remove(routeNames ...string) *VersionDef {
+	v.removed = append(v.removed, routeNames...)
+	return v
+}
+
+// Deprecate marks the version as deprecated. If since isn't zero,
+// the responses of the version get a Deprecation header with the
+// date, which RFC 9745 requires; otherwise they get no header.
+func (v *VersionDef) Deprecate(since time.Time) *VersionDef {
+	v.deprecated = true
+	v.since = since
+	return v
+}
+
+// Sunset adds a Sunset header with the date the version goes away.
+func (v *VersionDef) Sunset(at time.Time) *VersionDef {
+	v.sunset = at
+	return v
+}
+
+// From copies the destination from another tree, see ReRouteDef.From
+func (v *VersionDef) From(tree *RouteDef) *VersionDef {
+	v.reroute.From(tree)
+	return v
+}
+
+func (v *VersionDef) Use(mws ...Middleware) *VersionDef {
+	v.reroute.Use(mws...)
+	return v
+}
+
+func (v *VersionDef) Hooks(hooks ...Hook) *VersionDef {
+	v.reroute.hooks = append(v.reroute.hooks, hooks...)
+	return v
+}
+
+func (v *VersionDef) Guards(guards ...Guard) *VersionDef {
+	v.reroute.guards = append(v.reroute.guards, guards...)
+	return v
+}
+
+// apply changes the re-routed copy of the destination
+// into the version
+func (v *VersionDef) apply(clone *RouteDef) {
+	clone.version = v
+	if v.header {
+		clone.transformer = Group(clone.transformer, Headers(VersionHeader, v.name))
+	}
+	if v.deprecated || !v.sunset.IsZero() {
+		clone.middleware = append(append([]Middleware{}, clone.middleware...),
+			v.deprecation())
+	}
+
+	report := func(name, msg string) {
+		clone.problems = append(clone.problems, &ValidationError{
+			Kind:  UnknownVersionRoute,
+			Route: clone.Name,
+			Path:  clone.Path,
+			Msg:   fmt.Sprintf("%s %q is not in the destination %q", msg, name, v.reroute.destName),
+		})
+	}
+	find := func(name string) *RouteDef {
+		return clone.Search(v.reroute.namePrefix + REROUTE_SEP + name)
+	}
+
+	var names []string
+	for name := range v.overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r := find(name)
+		if r == nil {
+			report(name, "overridden route")
+			continue
+		}
+		r.Handler = v.overrides[name]
+	}
+
+	for _, name := range v.removed {
+		r := find(name)
+		if r == nil || r == clone {
+			report(name, "removed route")
+			continue
+		}
+		var subroutes []*RouteDef
+		for _, sub := range r.parent.subroutes {
+			if sub != r {
+				subroutes = append(subroutes, sub)
+			}
+		}
+		r.parent.subroutes = subroutes
+	}
+}
+
+func (v *VersionDef) deprecation() Middleware {
+	return func(next ht.Handler) ht.Handler {
+		return ht.HandlerFunc(func(w ht.ResponseWriter, r *ht.Request) {
+			if v.deprecated && !v.since.IsZero() {
+				w.Header().Set("Deprecation",
+					"@"+strconv.FormatInt(v.since.Unix(), 10))
+			}
+			if !v.sunset.IsZero() {
+				w.Header().Set("Sunset", v.sunset.UTC().Format(ht.TimeFormat))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Version returns the version the route belongs to, or nil.
+func (r *RouteDef) Version() *VersionDef {
+	for ; r != nil; r = r.parent {
+		if r.version != nil {
+			return r.version
+		}
+	}
+	return nil
+}
+
+// A VersionTable is the route table of a version,
+// or of the routes outside of versions if Version is nil.
+type VersionTable struct {
+	Version *VersionDef
+	Entries []Entry
+}
+
+// VersionTables is like Table, with the routes grouped by version.
+// The routes outside of versions come first.
+func (r *RouteDef) VersionTables(splitMethodsOpt ...bool) []VersionTable {
+	splitMethods := len(splitMethodsOpt) > 0 && splitMethodsOpt[0]
+	tables := []VersionTable{{}}
+	index := map[*VersionDef]int{nil: 0}
+	r.Iter(func(sub *RouteDef) {
+		v := sub.Version()
+		i, ok := index[v]
+		if !ok {
+			i = len(tables)
+			index[v] = i
+			tables = append(tables, VersionTable{Version: v})
+		}
+		tables[i].Entries = append(tables[i].Entries, tableEntries(sub, splitMethods)...)
+	})
+	if len(tables[0].Entries) == 0 {
+		tables = tables[1:]
+	}
+	return tables
+}
+
+// the heading of the version in the formatted route table
+func (t VersionTable) heading() string {
+	v := t.Version
+	if v == nil {
+		return ""
+	}
+	notes := []string{}
+	if v.header {
+		notes = append(notes, VersionHeader+": "+v.name)
+	}
+	if v.deprecated {
+		notes = append(notes, "deprecated")
+	}
+	if !v.sunset.IsZero() {
+		notes = append(notes, "sunset "+v.sunset.Format("2006-01-02"))
+	}
+	heading := "[" + v.name + "]"
+	if len(notes) > 0 {
+		heading += " " + strings.Join(notes, ", ")
+	}
+	return heading
+}